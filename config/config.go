@@ -0,0 +1,769 @@
+// Package config reads the sidecar configuration file. The file declares the
+// groups of series to analyze and, for each group, which models run on it and
+// with what parameters.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/open-fresh/data-sidecar/prompb"
+	"github.com/open-fresh/data-sidecar/scoring/anomaly"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultQueryWorkers is how many range queries run at once unless told otherwise.
+	DefaultQueryWorkers = 4
+	// DefaultQueryTimeout is how long a single query may take, in seconds.
+	DefaultQueryTimeout = 15
+	// DefaultMaxBackfill is the longest gap, in seconds, fetched again after
+	// prometheus could not be reached.
+	DefaultMaxBackfill = 3600
+	// DefaultWriteCapacity is how many exported samples wait to be sent by
+	// remote write before the oldest are dropped.
+	DefaultWriteCapacity = 10000
+	// DefaultWriteBatch is the most samples sent by remote write at once.
+	DefaultWriteBatch = 500
+	// DefaultWriteDeadline is how long, in seconds, samples wait for a batch
+	// to fill up before it is sent anyway.
+	DefaultWriteDeadline = 5
+	// DefaultWriteRetries is how often a batch that failed is sent again.
+	DefaultWriteRetries = 3
+)
+
+// Config is the top level of the configuration file. Anything left out of the
+// file keeps the value it had before loading, which is how commandline flags
+// act as defaults.
+type Config struct {
+	Prometheus   string        `yaml:"prometheus"`
+	Resolution   int           `yaml:"resolution"`
+	Lookback     int           `yaml:"lookback"`
+	Cleanup      int           `yaml:"cleanup"`
+	Prefix       string        `yaml:"prefix"`
+	Timestamps   bool          `yaml:"exposition_timestamps"`
+	RingLength   int           `yaml:"ring_length"`
+	QueryWorkers int           `yaml:"query_workers"`
+	QueryTimeout int           `yaml:"query_timeout"`
+	MaxBackfill  int           `yaml:"max_backfill"`
+	RemoteRead   string        `yaml:"remote_read"`
+	RemoteWrite  RemoteWrite   `yaml:"remote_write"`
+	Tenants      []Tenant      `yaml:"tenants"`
+	Groups       []TargetGroup `yaml:"target_groups"`
+
+	BasicAuth       *BasicAuth `yaml:"basic_auth"`
+	BearerToken     string     `yaml:"bearer_token"`
+	BearerTokenFile string     `yaml:"bearer_token_file"`
+	TLS             TLSConfig  `yaml:"tls_config"`
+}
+
+// BasicAuth is a username and password sent to prometheus. The password may
+// be kept in a file instead, which is read again when it changes.
+type BasicAuth struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+}
+
+// TLSConfig says how to check the certificate prometheus presents and which
+// certificate to present to it.
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// RemoteWrite sends everything the sidecar exports to a remote write
+// endpoint as well, when URL is set. Deadline is in seconds.
+type RemoteWrite struct {
+	URL        string `yaml:"url"`
+	Capacity   int    `yaml:"capacity"`
+	BatchSize  int    `yaml:"max_samples_per_send"`
+	Deadline   int    `yaml:"batch_send_deadline"`
+	MaxRetries int    `yaml:"max_retries"`
+}
+
+// Tenant is an organisation of a multi-tenant prometheus such as Cortex or
+// Mimir. Its series are fetched with its id as the X-Scope-OrgID and kept
+// apart from those of other tenants. QueryRate limits the queries sent for it
+// a second; zero does not limit them.
+type Tenant struct {
+	ID        string  `yaml:"id"`
+	QueryRate float64 `yaml:"query_rate"`
+}
+
+// TargetGroup is a set of selectors that are scored with the same models.
+// The selectors of a group that receives are not fetched; series pushed by
+// remote write are matched against them instead, so they must be plain
+// selectors.
+type TargetGroup struct {
+	Name       string   `yaml:"name"`
+	Selectors  []string `yaml:"selectors"`
+	Receive    bool     `yaml:"receive"`
+	RingLength int      `yaml:"ring_length"`
+	Models     *Models  `yaml:"models"`
+}
+
+// Models holds the settings of every model a group can run. A model left out
+// of a group's models block does not run for that group; leaving the whole
+// block out runs DefaultModels.
+type Models struct {
+	Highway     *HighwayConfig     `yaml:"highway"`
+	Nelson      *NelsonConfig      `yaml:"nelson"`
+	Seasonal    *SeasonalConfig    `yaml:"seasonal"`
+	HoltWinters *HoltWintersConfig `yaml:"holt_winters"`
+	Robust      *RobustConfig      `yaml:"robust"`
+	Quantile    *QuantileConfig    `yaml:"quantile"`
+	CUSUM       *CUSUMConfig       `yaml:"cusum"`
+	EWMA        *EWMAConfig        `yaml:"ewma"`
+	ChangePoint *ChangePointConfig `yaml:"changepoint"`
+	Trend       *TrendConfig       `yaml:"trend"`
+}
+
+// HighwayConfig configures the mean and standard deviation highway.
+type HighwayConfig struct {
+	Sigma     float64 `yaml:"sigma"`
+	MinPoints int     `yaml:"min_points"`
+}
+
+// NelsonConfig configures the nelson rules. Rules names the nelson and
+// western electric rules to run, as they appear in ft_model.
+type NelsonConfig struct {
+	Window    int      `yaml:"window"`
+	MinPoints int      `yaml:"min_points"`
+	Rules     []string `yaml:"rules"`
+}
+
+// SeasonalConfig configures the seasonal highway, which compares a point with
+// the same time in previous periods. Period and Window are in seconds.
+type SeasonalConfig struct {
+	Period    int     `yaml:"period"`
+	Periods   int     `yaml:"periods"`
+	Window    int     `yaml:"window"`
+	Sigma     float64 `yaml:"sigma"`
+	MinPoints int     `yaml:"min_points"`
+}
+
+// HoltWintersConfig configures exponential smoothing. Alpha, Beta and Gamma
+// smooth the level, trend and seasonal parts, Season is the number of points
+// in a season (0 for none) and MinPoints how many points warm the model up.
+type HoltWintersConfig struct {
+	Alpha     float64 `yaml:"alpha"`
+	Beta      float64 `yaml:"beta"`
+	Gamma     float64 `yaml:"gamma"`
+	Season    int     `yaml:"season"`
+	Sigma     float64 `yaml:"sigma"`
+	MinPoints int     `yaml:"min_points"`
+}
+
+// RobustConfig configures the median and median absolute deviation highway.
+type RobustConfig struct {
+	Sigma     float64 `yaml:"sigma"`
+	MinPoints int     `yaml:"min_points"`
+}
+
+// QuantileConfig configures the quantile band, which runs between two percentiles.
+type QuantileConfig struct {
+	Low       float64 `yaml:"low"`
+	High      float64 `yaml:"high"`
+	MinPoints int     `yaml:"min_points"`
+}
+
+// CUSUMConfig configures the cumulative sum control chart. The reference mean
+// and standard deviation are learned from the first Warmup points; K is the
+// slack allowed per point and H the sum that fires, both in standard deviations.
+type CUSUMConfig struct {
+	Warmup int     `yaml:"warmup"`
+	K      float64 `yaml:"k"`
+	H      float64 `yaml:"h"`
+}
+
+// EWMAConfig configures the exponentially weighted moving average control
+// chart. The reference is learned from the first Warmup points, Lambda weighs
+// each new point and the limits are L standard deviations of the average wide.
+type EWMAConfig struct {
+	Warmup int     `yaml:"warmup"`
+	Lambda float64 `yaml:"lambda"`
+	L      float64 `yaml:"l"`
+}
+
+// ChangePointConfig configures level shift detection. A shift needs
+// MinSegment points on either side of it, and the means of the two sides must
+// be Threshold standard errors apart.
+type ChangePointConfig struct {
+	MinSegment int     `yaml:"min_segment"`
+	Threshold  float64 `yaml:"threshold"`
+}
+
+// TrendConfig configures the linear trend forecast. The trend is fitted over
+// Lookback seconds of history and extended to each of Horizons seconds ahead.
+// Limit is a PromQL expression for the value the series should not reach.
+type TrendConfig struct {
+	Lookback  int    `yaml:"lookback"`
+	Horizons  []int  `yaml:"horizons"`
+	Limit     string `yaml:"limit"`
+	MinPoints int    `yaml:"min_points"`
+}
+
+// DefaultHighway is what a highway runs with unless told otherwise.
+func DefaultHighway() HighwayConfig {
+	return HighwayConfig{Sigma: 3, MinPoints: 20}
+}
+
+// DefaultNelson is what the nelson rules run with unless told otherwise.
+func DefaultNelson() NelsonConfig {
+	return NelsonConfig{Window: 30, MinPoints: 2, Rules: append([]string(nil), anomaly.DefaultRules...)}
+}
+
+// DefaultSeasonal compares against the same time of day over the last four days.
+func DefaultSeasonal() SeasonalConfig {
+	return SeasonalConfig{Period: 86400, Periods: 4, Window: 300, Sigma: 3, MinPoints: 10}
+}
+
+// DefaultHoltWinters smooths without seasonality.
+func DefaultHoltWinters() HoltWintersConfig {
+	return HoltWintersConfig{Alpha: 0.3, Beta: 0.1, Gamma: 0.1, Sigma: 3, MinPoints: 10}
+}
+
+// DefaultRobust is as wide as the default highway would be on normal data.
+func DefaultRobust() RobustConfig {
+	return RobustConfig{Sigma: 3, MinPoints: 20}
+}
+
+// DefaultQuantile runs between the 5th and 95th percentiles.
+func DefaultQuantile() QuantileConfig {
+	return QuantileConfig{Low: 0.05, High: 0.95, MinPoints: 20}
+}
+
+// DefaultCUSUM catches a drift of a standard deviation within about ten points.
+func DefaultCUSUM() CUSUMConfig {
+	return CUSUMConfig{Warmup: 30, K: 0.5, H: 5}
+}
+
+// DefaultEWMA is the textbook chart for small shifts.
+func DefaultEWMA() EWMAConfig {
+	return EWMAConfig{Warmup: 30, Lambda: 0.2, L: 3}
+}
+
+// DefaultChangePoint is well clear of the shifts noise produces over a ring.
+func DefaultChangePoint() ChangePointConfig {
+	return ChangePointConfig{MinSegment: 5, Threshold: 6}
+}
+
+// DefaultTrend looks a day back to see an hour and a day ahead.
+func DefaultTrend() TrendConfig {
+	return TrendConfig{Lookback: 86400, Horizons: []int{3600, 86400}, MinPoints: 10}
+}
+
+// DefaultModels runs the highway and nelson rules with their default
+// settings. The seasonal highway queries prometheus for history, so it only
+// runs when asked for.
+func DefaultModels() Models {
+	highway := DefaultHighway()
+	nelson := DefaultNelson()
+	return Models{Highway: &highway, Nelson: &nelson}
+}
+
+// The model settings are unmarshaled on top of their defaults, so that those
+// left out of a group's models block keep them while an explicit zero is kept
+// for Validate to accept or reject.
+
+// UnmarshalYAML fills in DefaultHighway for the settings left out.
+func (c *HighwayConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultHighway()
+	type plain HighwayConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalYAML fills in DefaultNelson for the settings left out.
+func (c *NelsonConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultNelson()
+	type plain NelsonConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalYAML fills in DefaultSeasonal for the settings left out.
+func (c *SeasonalConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultSeasonal()
+	type plain SeasonalConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalYAML fills in DefaultHoltWinters for the settings left out.
+func (c *HoltWintersConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultHoltWinters()
+	type plain HoltWintersConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalYAML fills in DefaultRobust for the settings left out.
+func (c *RobustConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultRobust()
+	type plain RobustConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalYAML fills in DefaultQuantile for the settings left out.
+func (c *QuantileConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultQuantile()
+	type plain QuantileConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalYAML fills in DefaultCUSUM for the settings left out.
+func (c *CUSUMConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultCUSUM()
+	type plain CUSUMConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalYAML fills in DefaultEWMA for the settings left out.
+func (c *EWMAConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultEWMA()
+	type plain EWMAConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalYAML fills in DefaultChangePoint for the settings left out.
+func (c *ChangePointConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultChangePoint()
+	type plain ChangePointConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalYAML fills in DefaultTrend for the settings left out.
+func (c *TrendConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultTrend()
+	type plain TrendConfig
+	return unmarshal((*plain)(c))
+}
+
+// Load parses a configuration on top of base and validates the result.
+func Load(in []byte, base Config) (Config, error) {
+	cfg := base
+	cfg.Groups = nil
+	cfg.RemoteWrite.fill()
+	if err := yaml.UnmarshalStrict(in, &cfg); err != nil {
+		return base, err
+	}
+	if len(cfg.Groups) == 0 {
+		cfg.Groups = base.Groups
+	}
+	cfg.fill()
+	if err := cfg.Validate(); err != nil {
+		return base, err
+	}
+	return cfg, nil
+}
+
+// LoadFile reads a configuration file on top of base and validates the result.
+func LoadFile(filename string, base Config) (Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return base, err
+	}
+	cfg, err := Load(content, base)
+	if err != nil {
+		return base, fmt.Errorf("parsing %s: %v", filename, err)
+	}
+	return cfg, nil
+}
+
+// fill replaces unset settings with their defaults.
+func (c *Config) fill() {
+	if c.QueryWorkers == 0 {
+		c.QueryWorkers = DefaultQueryWorkers
+	}
+	if c.QueryTimeout == 0 {
+		c.QueryTimeout = DefaultQueryTimeout
+	}
+	if c.MaxBackfill == 0 {
+		c.MaxBackfill = DefaultMaxBackfill
+	}
+	for ii := range c.Groups {
+		group := &c.Groups[ii]
+		if group.RingLength == 0 {
+			group.RingLength = c.RingLength
+		}
+		if group.Models == nil {
+			models := DefaultModels()
+			group.Models = &models
+		}
+	}
+}
+
+// Validate reports the first problem found in a configuration.
+func (c *Config) Validate() error {
+	if _, err := url.Parse(c.Prometheus); err != nil || c.Prometheus == "" {
+		return fmt.Errorf("prometheus: %q is not a valid url", c.Prometheus)
+	}
+	if c.Resolution <= 0 {
+		return fmt.Errorf("resolution: must be positive, got %d", c.Resolution)
+	}
+	if c.Lookback <= 0 {
+		return fmt.Errorf("lookback: must be positive, got %d", c.Lookback)
+	}
+	if c.Cleanup <= 0 {
+		return fmt.Errorf("cleanup: must be positive, got %d", c.Cleanup)
+	}
+	if c.RingLength < 2 {
+		return fmt.Errorf("ring_length: must be at least 2, got %d", c.RingLength)
+	}
+	if c.QueryWorkers < 0 {
+		return fmt.Errorf("query_workers: must be positive, got %d", c.QueryWorkers)
+	}
+	if c.QueryTimeout < 0 {
+		return fmt.Errorf("query_timeout: must be positive, got %d", c.QueryTimeout)
+	}
+	if c.MaxBackfill < 0 {
+		return fmt.Errorf("max_backfill: must be positive, got %d", c.MaxBackfill)
+	}
+	if u, err := url.Parse(c.RemoteRead); c.RemoteRead != "" && (err != nil || u.Host == "") {
+		return fmt.Errorf("remote_read: %q is not a valid url", c.RemoteRead)
+	}
+	if err := c.RemoteWrite.validate(); err != nil {
+		return err
+	}
+	if err := c.validateAuth(); err != nil {
+		return err
+	}
+	tenants := make(map[string]bool)
+	for ii, tenant := range c.Tenants {
+		where := fmt.Sprintf("tenants[%d]", ii)
+		if tenant.ID == "" {
+			return fmt.Errorf("%s.id: must not be empty", where)
+		}
+		where = fmt.Sprintf("tenants[%d] (%s)", ii, tenant.ID)
+		if tenants[tenant.ID] {
+			return fmt.Errorf("%s.id: duplicate tenant", where)
+		}
+		tenants[tenant.ID] = true
+		if tenant.QueryRate < 0 {
+			return fmt.Errorf("%s.query_rate: must be positive, got %v", where, tenant.QueryRate)
+		}
+	}
+	if len(c.Groups) == 0 {
+		return fmt.Errorf("target_groups: at least one group is required")
+	}
+	names := make(map[string]bool)
+	selectors := make(map[string]string)
+	for ii, group := range c.Groups {
+		where := fmt.Sprintf("target_groups[%d]", ii)
+		if group.Name == "" {
+			return fmt.Errorf("%s.name: must not be empty", where)
+		}
+		where = fmt.Sprintf("target_groups[%d] (%s)", ii, group.Name)
+		if names[group.Name] {
+			return fmt.Errorf("%s.name: duplicate group name", where)
+		}
+		names[group.Name] = true
+		if len(group.Selectors) == 0 {
+			return fmt.Errorf("%s.selectors: at least one selector is required", where)
+		}
+		for jj, sel := range group.Selectors {
+			if strings.TrimSpace(sel) == "" {
+				return fmt.Errorf("%s.selectors[%d]: must not be empty", where, jj)
+			}
+			if other, ok := selectors[sel]; ok {
+				return fmt.Errorf("%s.selectors[%d]: %s is already used by group %s", where, jj, sel, other)
+			}
+			if _, ok := prompb.ParseSelector(sel); group.Receive && !ok {
+				return fmt.Errorf("%s.selectors[%d]: %s is not a plain selector, which receiving groups need", where, jj, sel)
+			}
+			selectors[sel] = group.Name
+		}
+		if group.RingLength < 2 {
+			return fmt.Errorf("%s.ring_length: must be at least 2, got %d", where, group.RingLength)
+		}
+		if err := group.Models.validate(); err != nil {
+			return fmt.Errorf("%s.models.%v", where, err)
+		}
+		if err := group.Models.fitRing(group.RingLength); err != nil {
+			return fmt.Errorf("%s.models.%v", where, err)
+		}
+	}
+	return nil
+}
+
+func (m *Models) validate() error {
+	if hwy := m.Highway; hwy != nil {
+		if hwy.Sigma <= 0 {
+			return fmt.Errorf("highway.sigma: must be positive, got %v", hwy.Sigma)
+		}
+		if hwy.MinPoints < 2 {
+			return fmt.Errorf("highway.min_points: must be at least 2, got %d", hwy.MinPoints)
+		}
+	}
+	if nel := m.Nelson; nel != nil {
+		if nel.Window < 5 {
+			return fmt.Errorf("nelson.window: must be at least 5, got %d", nel.Window)
+		}
+		if nel.MinPoints < 2 {
+			return fmt.Errorf("nelson.min_points: must be at least 2, got %d", nel.MinPoints)
+		}
+		if len(nel.Rules) == 0 {
+			return fmt.Errorf("nelson.rules: at least one rule is required")
+		}
+		seen := make(map[string]bool)
+		for ii, name := range nel.Rules {
+			rule, ok := anomaly.Rules[name]
+			if !ok {
+				return fmt.Errorf("nelson.rules[%d]: unknown rule %q", ii, name)
+			}
+			if seen[name] {
+				return fmt.Errorf("nelson.rules[%d]: duplicate rule %q", ii, name)
+			}
+			seen[name] = true
+			if rule.Points > nel.Window {
+				return fmt.Errorf("nelson.rules[%d]: %s looks at %d points, more than the window of %d", ii, name, rule.Points, nel.Window)
+			}
+		}
+	}
+	if sea := m.Seasonal; sea != nil {
+		if sea.Period <= 0 {
+			return fmt.Errorf("seasonal.period: must be positive, got %d", sea.Period)
+		}
+		if sea.Periods < 1 {
+			return fmt.Errorf("seasonal.periods: must be at least 1, got %d", sea.Periods)
+		}
+		if sea.Window < 0 || 2*sea.Window >= sea.Period {
+			return fmt.Errorf("seasonal.window: must be between 0 and half the period, got %d", sea.Window)
+		}
+		if sea.Sigma <= 0 {
+			return fmt.Errorf("seasonal.sigma: must be positive, got %v", sea.Sigma)
+		}
+		if sea.MinPoints < 2 {
+			return fmt.Errorf("seasonal.min_points: must be at least 2, got %d", sea.MinPoints)
+		}
+	}
+	if hw := m.HoltWinters; hw != nil {
+		names := []string{"alpha", "beta", "gamma"}
+		for ii, val := range []float64{hw.Alpha, hw.Beta, hw.Gamma} {
+			if val <= 0 || val > 1 {
+				return fmt.Errorf("holt_winters.%s: must be in (0, 1], got %v", names[ii], val)
+			}
+		}
+		if hw.Season < 0 || hw.Season == 1 {
+			return fmt.Errorf("holt_winters.season: must be 0 or at least 2, got %d", hw.Season)
+		}
+		if hw.Sigma <= 0 {
+			return fmt.Errorf("holt_winters.sigma: must be positive, got %v", hw.Sigma)
+		}
+		if hw.MinPoints < 2 {
+			return fmt.Errorf("holt_winters.min_points: must be at least 2, got %d", hw.MinPoints)
+		}
+	}
+	if rob := m.Robust; rob != nil {
+		if rob.Sigma <= 0 {
+			return fmt.Errorf("robust.sigma: must be positive, got %v", rob.Sigma)
+		}
+		if rob.MinPoints < 2 {
+			return fmt.Errorf("robust.min_points: must be at least 2, got %d", rob.MinPoints)
+		}
+	}
+	if cus := m.CUSUM; cus != nil {
+		if cus.Warmup < 2 {
+			return fmt.Errorf("cusum.warmup: must be at least 2, got %d", cus.Warmup)
+		}
+		if cus.K < 0 {
+			return fmt.Errorf("cusum.k: must not be negative, got %v", cus.K)
+		}
+		if cus.H <= 0 {
+			return fmt.Errorf("cusum.h: must be positive, got %v", cus.H)
+		}
+	}
+	if ewm := m.EWMA; ewm != nil {
+		if ewm.Warmup < 2 {
+			return fmt.Errorf("ewma.warmup: must be at least 2, got %d", ewm.Warmup)
+		}
+		if ewm.Lambda <= 0 || ewm.Lambda > 1 {
+			return fmt.Errorf("ewma.lambda: must be in (0, 1], got %v", ewm.Lambda)
+		}
+		if ewm.L <= 0 {
+			return fmt.Errorf("ewma.l: must be positive, got %v", ewm.L)
+		}
+	}
+	if cha := m.ChangePoint; cha != nil {
+		if cha.MinSegment < 2 {
+			return fmt.Errorf("changepoint.min_segment: must be at least 2, got %d", cha.MinSegment)
+		}
+		if cha.Threshold <= 0 {
+			return fmt.Errorf("changepoint.threshold: must be positive, got %v", cha.Threshold)
+		}
+	}
+	if tre := m.Trend; tre != nil {
+		if tre.Lookback <= 0 {
+			return fmt.Errorf("trend.lookback: must be positive, got %d", tre.Lookback)
+		}
+		if len(tre.Horizons) == 0 {
+			return fmt.Errorf("trend.horizons: at least one horizon is required")
+		}
+		for ii, horizon := range tre.Horizons {
+			if horizon <= 0 {
+				return fmt.Errorf("trend.horizons[%d]: must be positive, got %d", ii, horizon)
+			}
+		}
+		if tre.MinPoints < 2 {
+			return fmt.Errorf("trend.min_points: must be at least 2, got %d", tre.MinPoints)
+		}
+	}
+	if qua := m.Quantile; qua != nil {
+		if qua.Low <= 0 || qua.High >= 1 || qua.Low >= qua.High {
+			return fmt.Errorf("quantile: need 0 < low < high < 1, got low %v and high %v", qua.Low, qua.High)
+		}
+		if qua.MinPoints < 2 {
+			return fmt.Errorf("quantile.min_points: must be at least 2, got %d", qua.MinPoints)
+		}
+	}
+	return nil
+}
+
+// fitRing checks that the models drawing on the ring buffer can ever get
+// enough points out of it.
+func (m *Models) fitRing(length int) error {
+	var names []string
+	var needs []int
+	if m.Highway != nil {
+		names, needs = append(names, "highway.min_points"), append(needs, m.Highway.MinPoints)
+	}
+	if m.Robust != nil {
+		names, needs = append(names, "robust.min_points"), append(needs, m.Robust.MinPoints)
+	}
+	if m.Quantile != nil {
+		names, needs = append(names, "quantile.min_points"), append(needs, m.Quantile.MinPoints)
+	}
+	if m.Nelson != nil {
+		names, needs = append(names, "nelson.window", "nelson.min_points"), append(needs, m.Nelson.Window, m.Nelson.MinPoints)
+	}
+	for ii, need := range needs {
+		if need > length {
+			return fmt.Errorf("%s: %d is more than the ring_length of %d", names[ii], need, length)
+		}
+	}
+	if cha := m.ChangePoint; cha != nil && 2*cha.MinSegment > length {
+		return fmt.Errorf("changepoint.min_segment: two segments of %d do not fit the ring_length of %d", cha.MinSegment, length)
+	}
+	return nil
+}
+
+// fill gives the remote write settings the base left unset their defaults.
+// It runs before the file is read, so that the file can still set them to
+// zero, as max_retries: 0 does to send each batch only once.
+func (w *RemoteWrite) fill() {
+	if w.Capacity == 0 {
+		w.Capacity = DefaultWriteCapacity
+	}
+	if w.BatchSize == 0 {
+		w.BatchSize = DefaultWriteBatch
+	}
+	if w.Deadline == 0 {
+		w.Deadline = DefaultWriteDeadline
+	}
+	if w.MaxRetries == 0 {
+		w.MaxRetries = DefaultWriteRetries
+	}
+}
+
+func (w *RemoteWrite) validate() error {
+	if u, err := url.Parse(w.URL); w.URL != "" && (err != nil || u.Host == "") {
+		return fmt.Errorf("remote_write.url: %q is not a valid url", w.URL)
+	}
+	if w.Capacity < 1 {
+		return fmt.Errorf("remote_write.capacity: must be positive, got %d", w.Capacity)
+	}
+	if w.BatchSize < 1 || w.BatchSize > w.Capacity {
+		return fmt.Errorf("remote_write.max_samples_per_send: must be between 1 and the capacity of %d, got %d", w.Capacity, w.BatchSize)
+	}
+	if w.Deadline < 1 {
+		return fmt.Errorf("remote_write.batch_send_deadline: must be positive, got %d", w.Deadline)
+	}
+	if w.MaxRetries < 0 {
+		return fmt.Errorf("remote_write.max_retries: must be positive, got %d", w.MaxRetries)
+	}
+	return nil
+}
+
+// validateAuth checks that the ways of authenticating to prometheus do not
+// contradict each other.
+func (c *Config) validateAuth() error {
+	ways := 0
+	if c.BasicAuth != nil {
+		ways++
+		if c.BasicAuth.Username == "" {
+			return fmt.Errorf("basic_auth.username: must not be empty")
+		}
+		if c.BasicAuth.Password != "" && c.BasicAuth.PasswordFile != "" {
+			return fmt.Errorf("basic_auth: at most one of password and password_file")
+		}
+	}
+	if c.BearerToken != "" {
+		ways++
+	}
+	if c.BearerTokenFile != "" {
+		ways++
+	}
+	if ways > 1 {
+		return fmt.Errorf("at most one of basic_auth, bearer_token and bearer_token_file")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls_config: cert_file and key_file must be given together")
+	}
+	return nil
+}
+
+// TenantList lists the tenants to fetch series for. Without any there is a
+// single unnamed tenant, which sends no X-Scope-OrgID.
+func (c *Config) TenantList() []Tenant {
+	if len(c.Tenants) == 0 {
+		return []Tenant{{}}
+	}
+	return append([]Tenant{}, c.Tenants...)
+}
+
+// Selectors lists the selectors of every group that is fetched.
+func (c *Config) Selectors() []string {
+	out := make([]string, 0)
+	for _, group := range c.Groups {
+		if !group.Receive {
+			out = append(out, group.Selectors...)
+		}
+	}
+	return out
+}
+
+// ReceiveSelectors lists the selectors of every group that receives.
+func (c *Config) ReceiveSelectors() []string {
+	out := make([]string, 0)
+	for _, group := range c.Groups {
+		if group.Receive {
+			out = append(out, group.Selectors...)
+		}
+	}
+	return out
+}
+
+// LengthsBySelector maps each selector to the ring length of its group.
+func (c *Config) LengthsBySelector() map[string]int {
+	out := make(map[string]int)
+	for _, group := range c.Groups {
+		for _, sel := range group.Selectors {
+			out[sel] = group.RingLength
+		}
+	}
+	return out
+}
+
+// ModelsBySelector maps each selector to the models of its group.
+func (c *Config) ModelsBySelector() map[string]Models {
+	out := make(map[string]Models)
+	for _, group := range c.Groups {
+		for _, sel := range group.Selectors {
+			out[sel] = *group.Models
+		}
+	}
+	return out
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var base = Config{
+	Prometheus: "http://localhost:9090",
+	Resolution: 10,
+	Lookback:   60,
+	Cleanup:    300,
+	Prefix:     "ft_",
+	RingLength: 30,
+	Groups:     []TargetGroup{{Name: "default", Selectors: []string{`{ft_target="true"}`}}},
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("empty keeps the base", func(t *testing.T) {
+		cfg, err := Load([]byte{}, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Resolution != 10 || len(cfg.Groups) != 1 || cfg.Groups[0].Models.Highway.Sigma != 3 {
+			t.Error(cfg)
+		}
+	})
+	t.Run("groups and models", func(t *testing.T) {
+		cfg, err := Load([]byte(`
+resolution: 30
+target_groups:
+- name: cadvisor
+  selectors: ['{job="cadvisor"}']
+  models:
+    highway:
+      sigma: 2
+- name: requests
+  selectors: ['rate(http_requests_total[5m])']
+  ring_length: 40
+  models:
+    nelson:
+      window: 10
+      rules: [nelson_trend, western_electric_4]
+    seasonal:
+      period: 604800
+    holt_winters:
+      alpha: 0.5
+      season: 24
+    quantile:
+      high: 0.99
+    cusum:
+      h: 4
+    trend:
+      limit: http_requests_limit
+`), base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Resolution != 30 || cfg.Lookback != 60 {
+			t.Error(cfg)
+		}
+		if lengths := cfg.LengthsBySelector(); lengths[`{job="cadvisor"}`] != 30 || lengths[`rate(http_requests_total[5m])`] != 40 {
+			t.Error(lengths)
+		}
+		models := cfg.ModelsBySelector()
+		cadvisor := models[`{job="cadvisor"}`]
+		if cadvisor.Highway.Sigma != 2 || cadvisor.Highway.MinPoints != 20 || cadvisor.Nelson != nil {
+			t.Error(cadvisor)
+		}
+		requests := models[`rate(http_requests_total[5m])`]
+		if requests.Highway != nil || requests.Nelson.Window != 10 || requests.Nelson.MinPoints != 2 {
+			t.Error(requests)
+		}
+		if rules := requests.Nelson.Rules; len(rules) != 2 || rules[0] != "nelson_trend" {
+			t.Error(rules)
+		}
+		if hw := requests.HoltWinters; hw.Alpha != 0.5 || hw.Beta != 0.1 || hw.Season != 24 {
+			t.Error(hw)
+		}
+		if sea := requests.Seasonal; sea.Period != 604800 || sea.Periods != 4 || sea.Window != 300 || cadvisor.Seasonal != nil {
+			t.Error(sea)
+		}
+		if qua := requests.Quantile; qua.Low != 0.05 || qua.High != 0.99 || qua.MinPoints != 20 || requests.Robust != nil {
+			t.Error(qua)
+		}
+		if cus := requests.CUSUM; cus.H != 4 || cus.K != 0.5 || cus.Warmup != 30 || requests.EWMA != nil {
+			t.Error(cus)
+		}
+		if tre := requests.Trend; tre.Lookback != 86400 || len(tre.Horizons) != 2 || tre.Limit != "http_requests_limit" {
+			t.Error(tre)
+		}
+		if g := cfg.Selectors(); len(g) != 2 {
+			t.Error(g)
+		}
+	})
+	t.Run("explicit zeros", func(t *testing.T) {
+		cfg, err := Load([]byte("target_groups: [{name: a, selectors: ['x'], models: {cusum: {k: 0}}}]"), base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		models := cfg.ModelsBySelector()["x"]
+		if cus := models.CUSUM; cus.K != 0 || cus.H != 5 {
+			t.Error("a zero slack should be kept", cus)
+		}
+	})
+	t.Run("tenants", func(t *testing.T) {
+		if g := base.TenantList(); len(g) != 1 || g[0].ID != "" {
+			t.Error("no tenants should mean one unnamed tenant", g)
+		}
+		cfg, err := Load([]byte("tenants: [{id: team-a, query_rate: 5}, {id: team-b}]"), base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := cfg.TenantList(); len(g) != 2 || g[0].ID != "team-a" || g[0].QueryRate != 5 || g[1].QueryRate != 0 {
+			t.Error(g)
+		}
+	})
+	t.Run("receive", func(t *testing.T) {
+		cfg, err := Load([]byte(`
+target_groups:
+- name: pulled
+  selectors: ['rate(up[5m])']
+- name: pushed
+  receive: true
+  selectors: ['up{job="a"}']
+`), base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := cfg.Selectors(); len(g) != 1 || g[0] != "rate(up[5m])" {
+			t.Error(g)
+		}
+		if g := cfg.ReceiveSelectors(); len(g) != 1 || g[0] != `up{job="a"}` {
+			t.Error(g)
+		}
+		if _, ok := cfg.ModelsBySelector()[`up{job="a"}`]; !ok {
+			t.Error("received selectors should have models")
+		}
+	})
+	t.Run("remote write", func(t *testing.T) {
+		cfg, err := Load([]byte{}, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := cfg.RemoteWrite; w.URL != "" || w.Capacity != DefaultWriteCapacity || w.MaxRetries != DefaultWriteRetries {
+			t.Error(w)
+		}
+		flags := base
+		flags.RemoteWrite.URL = "http://localhost:9090/api/v1/write"
+		cfg, err = Load([]byte("remote_write: {max_samples_per_send: 100}"), flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := cfg.RemoteWrite; w.URL != flags.RemoteWrite.URL || w.BatchSize != 100 || w.Deadline != DefaultWriteDeadline {
+			t.Error(w)
+		}
+		cfg, err = Load([]byte("remote_write: {max_retries: 0}"), flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := cfg.RemoteWrite; w.MaxRetries != 0 || w.Capacity != DefaultWriteCapacity {
+			t.Error("an explicit max_retries of 0 should be kept", w)
+		}
+	})
+	t.Run("auth", func(t *testing.T) {
+		cfg, err := Load([]byte(`
+basic_auth: {username: a, password_file: /run/secrets/password}
+tls_config: {ca_file: ca.pem, server_name: prometheus}
+`), base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.BasicAuth.Username != "a" || cfg.BasicAuth.PasswordFile != "/run/secrets/password" || cfg.TLS.ServerName != "prometheus" {
+			t.Error(cfg)
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		cases := map[string]string{
+			"resolution: -1":                                                "resolution: must be positive",
+			"query_workers: -2":                                             "query_workers: must be positive",
+			"max_backfill: -60":                                             "max_backfill: must be positive",
+			"remote_read: api/v1/read":                                      "remote_read: \"api/v1/read\" is not a valid url",
+			"remote_write: {url: localhost}":                                "remote_write.url: \"localhost\" is not a valid url",
+			"remote_write: {capacity: 10, max_samples_per_send: 20}":        "remote_write.max_samples_per_send: must be between 1 and the capacity of 10",
+			"remote_write: {capacity: 0}":                                   "remote_write.capacity: must be positive, got 0",
+			"remote_write: {batch_send_deadline: -5}":                       "remote_write.batch_send_deadline: must be positive",
+			"basic_auth: {password: x}":                                     "basic_auth.username: must not be empty",
+			"basic_auth: {username: a, password: x, password_file: y}":      "basic_auth: at most one of password and password_file",
+			"{basic_auth: {username: a}, bearer_token_file: x}":             "at most one of basic_auth, bearer_token and bearer_token_file",
+			"tls_config: {cert_file: x}":                                    "tls_config: cert_file and key_file must be given together",
+			"tenants: [{query_rate: 1}]":                                    "tenants[0].id: must not be empty",
+			"tenants: [{id: a}, {id: a}]":                                   "tenants[1] (a).id: duplicate",
+			"tenants: [{id: a, query_rate: -1}]":                            "tenants[0] (a).query_rate: must be positive",
+			"resolutoin: 1":                                                 "field resolutoin not found",
+			"ring_length: 1":                                                "ring_length: must be at least 2",
+			"target_groups: [{name: a, selectors: ['x'], ring_length: 10}]": "models.highway.min_points: 20 is more than the ring_length of 10",
+			"target_groups: [{selectors: ['{a=\"b\"}']}]":                   "target_groups[0].name: must not be empty",
+			"target_groups: [{name: a}]":                                    "target_groups[0] (a).selectors: at least one",
+			"target_groups: [{name: a, selectors: ['x']}, {name: a, selectors: ['y']}]":                                    "target_groups[1] (a).name: duplicate",
+			"target_groups: [{name: a, selectors: ['x']}, {name: b, selectors: ['x']}]":                                    "already used by group a",
+			"target_groups: [{name: a, receive: true, selectors: ['rate(x[5m])']}]":                                        "target_groups[0] (a).selectors[0]: rate(x[5m]) is not a plain selector",
+			"target_groups: [{name: a, selectors: ['x'], models: {highway: {sigma: -1}}}]":                                 "target_groups[0] (a).models.highway.sigma",
+			"target_groups: [{name: a, selectors: ['x'], models: {nelson: {window: 3}}}]":                                  "models.nelson.window",
+			"target_groups: [{name: a, selectors: ['x'], models: {seasonal: {window: 43200}}}]":                            "models.seasonal.window",
+			"target_groups: [{name: a, selectors: ['x'], models: {seasonal: {periods: -1}}}]":                              "models.seasonal.periods",
+			"target_groups: [{name: a, selectors: ['x'], models: {holt_winters: {beta: 2}}}]":                              "models.holt_winters.beta",
+			"target_groups: [{name: a, selectors: ['x'], models: {holt_winters: {season: 1}}}]":                            "models.holt_winters.season",
+			"target_groups: [{name: a, selectors: ['x'], models: {nelson: {rules: [nelson_bogus]}}}]":                      "models.nelson.rules[0]: unknown rule \"nelson_bogus\"",
+			"target_groups: [{name: a, selectors: ['x'], models: {nelson: {rules: [nelson_bias, nelson_bias]}}}]":          "models.nelson.rules[1]: duplicate",
+			"target_groups: [{name: a, selectors: ['x'], models: {nelson: {window: 10, rules: [nelson_oscillation]}}}]":    "nelson_oscillation looks at 14 points, more than the window of 10",
+			"target_groups: [{name: a, selectors: ['x'], models: {changepoint: {min_segment: 16}}}]":                       "models.changepoint.min_segment: two segments of 16 do not fit the ring_length of 30",
+			"target_groups: [{name: a, selectors: ['x'], models: {changepoint: {threshold: -1}}}]":                         "models.changepoint.threshold",
+			"target_groups: [{name: a, selectors: ['x'], models: {trend: {horizons: [3600, -60]}}}]":                       "models.trend.horizons[1]: must be positive",
+			"target_groups: [{name: a, selectors: ['x'], models: {cusum: {warmup: 1}}}]":                                   "models.cusum.warmup",
+			"target_groups: [{name: a, selectors: ['x'], models: {ewma: {lambda: 1.5}}}]":                                  "models.ewma.lambda: must be in (0, 1]",
+			"target_groups: [{name: a, selectors: ['x'], models: {robust: {sigma: -3}}}]":                                  "models.robust.sigma",
+			"target_groups: [{name: a, selectors: ['x'], models: {quantile: {low: 0.9, high: 0.1}}}]":                      "models.quantile: need 0 < low < high < 1",
+			"target_groups: [{name: a, selectors: ['x'], ring_length: 20, models: {nelson: {}}}]":                          "models.nelson.window: 30 is more than the ring_length of 20",
+			"target_groups: [{name: a, selectors: ['x'], ring_length: 10, models: {nelson: {window: 8, min_points: 12}}}]": "models.nelson.min_points: 12 is more than the ring_length of 10",
+			"target_groups: [{name: a, selectors: ['x'], ring_length: 10, models: {quantile: {min_points: 12}}}]":          "models.quantile.min_points: 12 is more than the ring_length of 10",
+			"target_groups: [{name: a, selectors: ['x'], models: {highway: {sigma: 0}}}]":                                  "models.highway.sigma: must be positive, got 0",
+			"target_groups: [{name: a, selectors: ['x'], models: {holt_winters: {alpha: 0}}}]":                             "models.holt_winters.alpha: must be in (0, 1], got 0",
+			"target_groups: [{name: a, selectors: ['x'], models: {nelson: {rules: []}}}]":                                  "models.nelson.rules: at least one rule",
+			"target_groups: [{name: a, selectors: ['x'], models: {trend: {horizons: []}}}]":                                "models.trend.horizons: at least one horizon",
+			"target_groups: [{name: a, selectors: ['x'], models: {highway: {sigmaa: 1}}}]":                                 "field sigmaa not found",
+			"target_groups: [{name: a, selectors: ['x'], models: {highway: {sigma: high}}}]":                               "cannot unmarshal",
+		}
+		for in, want := range cases {
+			cfg, err := Load([]byte(in), base)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: expected %q, got %v", in, want, err)
+			}
+			if cfg.Resolution != base.Resolution {
+				t.Error("a bad file should leave the base alone", cfg)
+			}
+		}
+	})
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "sidecar.yml")
+	if _, err := LoadFile(filename, base); err == nil {
+		t.Error("missing file should fail")
+	}
+	ioutil.WriteFile(filename, []byte("lookback: 0\n"), 0644)
+	if _, err := LoadFile(filename, base); err == nil || !strings.Contains(err.Error(), filename) {
+		t.Error(err)
+	}
+	ioutil.WriteFile(filename, []byte("lookback: 5\n"), 0644)
+	if cfg, err := LoadFile(filename, base); err != nil || cfg.Lookback != 5 {
+		t.Error(cfg, err)
+	}
+}
@@ -17,8 +17,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/open-fresh/data-sidecar/util"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 )
 
@@ -99,6 +101,11 @@ type Icarus struct {
 	Chan   chan util.Metric
 	prefix string
 	serve  *ServePage
+	writer *Writer
+	stamps bool
+	stale  int64
+	help   func(string) string
+	latest []*dto.MetricFamily
 }
 
 // NewIcarus builds and starts an icarus process.
@@ -109,9 +116,10 @@ func NewIcarus(prefix string) *Icarus {
 	sp.AddPage()
 	ticker := time.NewTicker(10 * time.Second)
 	i := Icarus{&mux, NewRollingStore(2), ticker,
-		make(chan util.Metric, 1), prefix, sp}
+		make(chan util.Metric, 1), prefix, sp, NewWriter(), false, 0, nil, nil}
 	go (&i).start()
 	go (&i).rollStore()
+	go i.writer.Run()
 	return &i
 }
 
@@ -122,11 +130,56 @@ func (i *Icarus) start() {
 		if val, ok := x.Desc["__name__"]; ok && (len(val) > 0) {
 			name = val
 		}
-		x.Desc["__name__"] = i.prefix + name
+		x.Desc["__name__"] = i.getPrefix() + name
 		i.Store.Insert(x)
+		i.writer.Add(x)
 	}
 }
 
+// SetTimestamps turns explicit timestamps in the exposition on or off. With
+// them on, metrics whose latest point is more than staleAfter seconds behind
+// the latest point of any metric are left out, rather than exposed at their
+// last value until they roll out of the store.
+func (i *Icarus) SetTimestamps(on bool, staleAfter int64) {
+	i.Lock()
+	defer i.Unlock()
+	i.stamps, i.stale = on, staleAfter
+}
+
+// SetHelp describes families, named without the prefix, for their HELP lines.
+func (i *Icarus) SetHelp(help func(family string) string) {
+	i.Lock()
+	defer i.Unlock()
+	i.help = help
+}
+
+// helpFor describes a family. It expects the lock to be held.
+func (i *Icarus) helpFor(name string) string {
+	if i.help == nil {
+		return "Generated by the data sidecar"
+	}
+	return i.help(strings.TrimPrefix(name, i.prefix))
+}
+
+// SetRemoteWrite sends everything recorded to a remote write endpoint as well
+// as exposing it, or stops sending when url is empty. See Writer.Set.
+func (i *Icarus) SetRemoteWrite(url string, capacity, batch int, deadline time.Duration, retries int) {
+	i.writer.Set(url, capacity, batch, deadline, retries)
+}
+
+// SetPrefix changes the prefix put in front of every exported metric.
+func (i *Icarus) SetPrefix(prefix string) {
+	i.Lock()
+	defer i.Unlock()
+	i.prefix = prefix
+}
+
+func (i *Icarus) getPrefix() string {
+	i.Lock()
+	defer i.Unlock()
+	return i.prefix
+}
+
 // Record puts things into the icarus channel.
 func (i *Icarus) Record(x util.Metric) {
 	i.Chan <- x
@@ -154,12 +207,31 @@ func (i *Icarus) rollStoreBusiness() {
 	i.Store.Roll()
 }
 
+// labelEscaper escapes label values for the text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// exported tells whether a label is exported along with a metric. The name
+// is not a label here; it is exported separately.
+func exported(key, val string) bool {
+	return (key != "_hash") && (key != "__name__") && (val != "") && (key != "ft_target")
+}
+
 // MetricToProm changes a map into a string.
 func MetricToProm(met util.Metric) string {
+	return formatMetric(met, false)
+}
+
+// MetricToPromTimestamped changes a map into a string that ends with the time
+// of the metric's point, in milliseconds.
+func MetricToPromTimestamped(met util.Metric) string {
+	return formatMetric(met, true)
+}
+
+func formatMetric(met util.Metric, stamped bool) string {
 	name := met.Desc["__name__"]
 	kvprune := make(map[string]string)
 	for key, val := range met.Desc {
-		if (key == "_hash") || (key == "__name__") || (val == "") || (key == "ft_target") {
+		if !exported(key, val) {
 			continue
 		}
 		kvprune[key] = val
@@ -173,30 +245,108 @@ func MetricToProm(met util.Metric) string {
 	out := make([]string, len(sorted))
 	sort.Strings(sorted)
 	for ii, xx := range sorted {
-		out[ii] = xx + "=\"" + met.Desc[xx] + "\""
+		out[ii] = xx + "=\"" + labelEscaper.Replace(met.Desc[xx]) + "\""
+	}
+	line := name + "{" + strings.Join(out, ",") + "} " + strconv.FormatFloat(met.Data.Val, 'f', -1, 32)
+	if stamped {
+		line += " " + strconv.FormatInt(met.Data.Time*1000, 10)
 	}
-	return name + "{" + strings.Join(out, ",") + "} " + strconv.FormatFloat(met.Data.Val, 'f', -1, 32) + "\n"
+	return line + "\n"
 }
 
-// rollup prepares the local store for emission.
+// exposed picks what is exposed out of the store, sorted by name and then by
+// labels so every family is in one piece. It expects the lock to be held.
+func (i *Icarus) exposed() []util.Metric {
+	useMets := i.Store.Dump()
+	latest := int64(math.MinInt64)
+	for _, val := range useMets {
+		if val.Data.Time > latest {
+			latest = val.Data.Time
+		}
+	}
+	type keyed struct {
+		name, key string
+		met       util.Metric
+	}
+	sorted := make([]keyed, 0, len(useMets))
+	// whatever the work item level is, the metric name, the anomalies
+	for _, val := range useMets {
+		if !math.IsNaN(val.Data.Val) && (!i.stamps || latest-val.Data.Time <= i.stale) {
+			sorted = append(sorted, keyed{val.Desc["__name__"], util.MapSSToS(val.Desc), val})
+		}
+	}
+	sort.Slice(sorted, func(aa, bb int) bool {
+		if sorted[aa].name != sorted[bb].name {
+			return sorted[aa].name < sorted[bb].name
+		}
+		return sorted[aa].key < sorted[bb].key
+	})
+	out := make([]util.Metric, len(sorted))
+	for ii, xx := range sorted {
+		out[ii] = xx.met
+	}
+	return out
+}
+
+// rollup prepares the local store for emission: the text page, and the
+// families the other formats are encoded from.
 func (i *Icarus) rollup() {
 	i.Lock()
 	defer i.Unlock()
 	useBuffer := bytes.NewBuffer([]byte("\n# These metrics generated by icarus.\n"))
-	useMets := i.Store.Dump()
-	metrics := 0
-	// whatever the work item level is, the metric name, the anomalies
+	useMets := i.exposed()
+	families := make([]*dto.MetricFamily, 0)
+	var family *dto.MetricFamily
 	for _, val := range useMets {
-		if !math.IsNaN(val.Data.Val) {
-			metrics++
-			useBuffer.Write([]byte(MetricToProm(val)))
+		name := val.Desc["__name__"]
+		if family == nil || family.GetName() != name {
+			family = &dto.MetricFamily{Name: proto.String(name), Help: proto.String(i.helpFor(name)), Type: dto.MetricType_GAUGE.Enum()}
+			families = append(families, family)
+			fmt.Fprintf(useBuffer, "# HELP %s %s\n# TYPE %s gauge\n", name, helpEscaper.Replace(family.GetHelp()), name)
+		}
+		family.Metric = append(family.Metric, i.toDTO(val))
+		if i.stamps {
+			useBuffer.WriteString(MetricToPromTimestamped(val))
+		} else {
+			useBuffer.WriteString(MetricToProm(val))
 		}
 	}
-	icarusReturnMetrics.WithLabelValues("metrics").Observe(float64(metrics))
+	icarusReturnMetrics.WithLabelValues("metrics").Observe(float64(len(useMets)))
+	i.latest = families
 	i.serve.Next().Write(useBuffer.String())
 	i.serve = i.serve.Next()
 }
 
+// helpEscaper escapes HELP text for the text exposition format.
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// toDTO turns a metric into what expfmt encodes, with the labels and value
+// the text page has. It expects the lock to be held.
+func (i *Icarus) toDTO(met util.Metric) *dto.Metric {
+	names := make([]string, 0, len(met.Desc))
+	for key, val := range met.Desc {
+		if exported(key, val) {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	out := &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(met.Data.Val)}}
+	for _, key := range names {
+		out.Label = append(out.Label, &dto.LabelPair{Name: proto.String(key), Value: proto.String(met.Desc[key])})
+	}
+	if i.stamps {
+		out.TimestampMs = proto.Int64(met.Data.Time * 1000)
+	}
+	return out
+}
+
+// families returns the families of the last rollup.
+func (i *Icarus) families() []*dto.MetricFamily {
+	i.Lock()
+	defer i.Unlock()
+	return i.latest
+}
+
 // aggPromDefaults gets everything out of the prometheus
 // default registry and preps it for sending.
 func aggPromDefaults(useBuffer *bytes.Buffer) {
@@ -207,12 +357,34 @@ func aggPromDefaults(useBuffer *bytes.Buffer) {
 	}
 }
 
-//HandleFunc is an http handlefunc function. Apes a prometheus endpoint.
+// HandleFunc is an http handlefunc function. Apes a prometheus endpoint.
+// The format follows the Accept header: the text format unless OpenMetrics
+// or protobuf is asked for.
 func (i *Icarus) HandleFunc(w http.ResponseWriter, r *http.Request) {
-	useBuffer := bytes.NewBufferString("")
-	aggPromDefaults(useBuffer)
-	output := useBuffer.String() + i.serve.Read()
 	icarusRequestCounter.Inc()
-	icarusReturnSize.Observe(float64(len(output)))
-	fmt.Fprint(w, output)
+	format := negotiate(r.Header)
+	w.Header().Set("Content-Type", string(format))
+	if format == expfmt.FmtText {
+		useBuffer := bytes.NewBufferString("")
+		aggPromDefaults(useBuffer)
+		output := useBuffer.String() + i.serve.Read()
+		icarusReturnSize.Observe(float64(len(output)))
+		fmt.Fprint(w, output)
+		return
+	}
+	mfs, _ := prometheus.DefaultGatherer.Gather()
+	mfs = append(mfs, i.families()...)
+	useBuffer := bytes.NewBufferString("")
+	if format == FmtOpenMetrics {
+		writeOpenMetrics(useBuffer, mfs)
+	} else {
+		enc := expfmt.NewEncoder(useBuffer, format)
+		for _, mf := range mfs {
+			if err := enc.Encode(mf); err != nil {
+				icarusErrorCounter.WithLabelValues("encode").Inc()
+			}
+		}
+	}
+	icarusReturnSize.Observe(float64(useBuffer.Len()))
+	w.Write(useBuffer.Bytes())
 }
@@ -33,15 +33,22 @@ func (r *IcarusStore) Roll() {
 	r.Metrics[r.Index] = make(map[string]util.Metric)
 }
 
-// Insert something into the current store in the rolling store
+// Insert something into the current store in the rolling store. A metric
+// older than the one kept for the same labels is ignored, so the time of
+// what is exposed never goes backwards.
 func (r *IcarusStore) Insert(met util.Metric) {
 	r.Lock()
 	defer r.Unlock()
 	label := util.MapSSToS(met.Desc)
+	for _, kept := range r.Metrics {
+		if old, ok := kept[label]; ok && old.Data.Time > met.Data.Time {
+			return
+		}
+	}
 	r.Metrics[r.Index][label] = met
 }
 
-// Dump all the []Metrics in the rolling store.
+// Dump all the []Metrics in the rolling store, the latest of each.
 func (r *IcarusStore) Dump() []util.Metric {
 	r.Lock()
 	defer r.Unlock()
@@ -49,7 +56,9 @@ func (r *IcarusStore) Dump() []util.Metric {
 	for ii := 1; ii <= r.Keep; ii++ {
 		loc := (r.Index + ii) % r.Keep
 		for key, val := range r.Metrics[loc] {
-			temp[key] = val
+			if old, ok := temp[key]; !ok || val.Data.Time >= old.Data.Time {
+				temp[key] = val
+			}
 		}
 	}
 	out := make([]util.Metric, len(temp), len(temp))
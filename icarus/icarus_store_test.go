@@ -31,6 +31,32 @@ func SuiteTestStore(t *testing.T, x *IcarusStore, cap int) {
 
 }
 
+func TestRollingStoreOrder(t *testing.T) {
+	x := NewRollingStore(2)
+	at := func(val float64, time int64) util.Metric {
+		return util.Metric{Desc: map[string]string{"__name__": "hello"}, Data: util.DataPoint{Val: val, Time: time}}
+	}
+	x.Insert(at(1, 20))
+	x.Roll()
+	x.Insert(at(2, 10))
+	if g := x.Dump(); len(g) != 1 || g[0].Data.Time != 20 || g[0].Data.Val != 1 {
+		t.Error("an older point should not replace a newer one from before the roll", g)
+	}
+	x.Insert(at(3, 20))
+	x.Insert(at(4, 30))
+	if g := x.Dump(); len(g) != 1 || g[0].Data.Time != 30 || g[0].Data.Val != 4 {
+		t.Error(g)
+	}
+	x.Roll()
+	if g := x.Dump(); len(g) != 1 || g[0].Data.Time != 30 {
+		t.Error("the latest point should outlive the roll", g)
+	}
+	x.Roll()
+	if g := x.Dump(); len(g) != 0 {
+		t.Error(g)
+	}
+}
+
 func TestRollingStore(t *testing.T) {
 	g := NewRollingStore(2)
 	SuiteTestStore(t, g, 2)
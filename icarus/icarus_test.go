@@ -70,3 +70,45 @@ func TestTableDenoising(t *testing.T) {
 		t.Error(g)
 	}
 }
+
+func TestMetricToPromEscaping(t *testing.T) {
+	g := MetricToProm(helper(map[string]string{"__name__": "x", "ft_selector": `{ft_target="true"}`}, 1))
+	if g != `x{ft_selector="{ft_target=\"true\"}"} 1`+"\n" {
+		t.Error(g)
+	}
+}
+
+func stamped(name, pod string, val float64, at int64) util.Metric {
+	return util.Metric{Desc: map[string]string{"__name__": name, "ft_pod": pod}, Data: util.DataPoint{Val: val, Time: at}}
+}
+
+func TestTimestamps(t *testing.T) {
+	if g := MetricToPromTimestamped(stamped("x", "a", 2, 1600000000)); g != `x{ft_pod="a"} 2 1600000000000`+"\n" {
+		t.Error(g)
+	}
+
+	i := NewIcarus("ft_")
+	i.SetTimestamps(true, 20)
+	i.Store.Insert(stamped("ft_x", "gone", 1, 100))
+	i.Store.Insert(stamped("ft_x_y", "a", 1, 110))
+	i.Store.Insert(stamped("ft_x", "a", 1, 120))
+	i.Store.Roll()
+	i.Store.Insert(stamped("ft_x", "b", 1, 130))
+	i.Store.Insert(stamped("ft_x", "a", 5, 110))
+	i.rollup()
+	want := "\n# These metrics generated by icarus.\n" +
+		"# HELP ft_x Generated by the data sidecar\n# TYPE ft_x gauge\n" +
+		`ft_x{ft_pod="a"} 1 120000` + "\n" +
+		`ft_x{ft_pod="b"} 1 130000` + "\n" +
+		"# HELP ft_x_y Generated by the data sidecar\n# TYPE ft_x_y gauge\n" +
+		`ft_x_y{ft_pod="a"} 1 110000` + "\n"
+	if g := i.serve.Read(); g != want {
+		t.Error("stale series should be left out, the rest grouped by name with their latest times\n", g)
+	}
+
+	i.SetTimestamps(false, 20)
+	i.rollup()
+	if g := i.serve.Read(); !strings.Contains(g, `ft_x{ft_pod="gone"} 1`+"\n") {
+		t.Error("without timestamps everything kept should be exposed", g)
+	}
+}
@@ -0,0 +1,138 @@
+package icarus
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// FmtOpenMetrics is the OpenMetrics text format. The vendored expfmt predates
+// it, so it is written here from the same metric families.
+const FmtOpenMetrics expfmt.Format = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// negotiate picks the format a scrape asks for in its Accept header, going
+// by the q values: OpenMetrics, any of the protobuf encodings expfmt knows,
+// or the text format, which is also what anything else gets.
+func negotiate(h http.Header) expfmt.Format {
+	best, bestQ := expfmt.FmtText, 0.0
+	for _, part := range strings.Split(h.Get("Accept"), ",") {
+		mediatype, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if val, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(val, 64); err != nil {
+				continue
+			}
+		}
+		var format expfmt.Format
+		switch {
+		case mediatype == "application/openmetrics-text":
+			format = FmtOpenMetrics
+		case mediatype == expfmt.ProtoType && params["proto"] == expfmt.ProtoProtocol:
+			format = expfmt.Negotiate(http.Header{"Accept": []string{part}})
+		case mediatype == "text/plain" || mediatype == "*/*":
+			format = expfmt.FmtText
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// writeOpenMetrics writes metric families in the OpenMetrics text format,
+// ending with the # EOF the format requires.
+func writeOpenMetrics(out io.Writer, families []*dto.MetricFamily) error {
+	w := bufio.NewWriter(out)
+	for _, mf := range families {
+		name, kind := mf.GetName(), "unknown"
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			kind = "counter"
+			name = strings.TrimSuffix(name, "_total")
+		case dto.MetricType_GAUGE:
+			kind = "gauge"
+		case dto.MetricType_SUMMARY:
+			kind = "summary"
+		case dto.MetricType_HISTOGRAM:
+			kind = "histogram"
+		}
+		w.WriteString("# TYPE " + name + " " + kind + "\n")
+		if mf.Help != nil {
+			w.WriteString("# HELP " + name + " " + labelEscaper.Replace(mf.GetHelp()) + "\n")
+		}
+		for _, met := range mf.Metric {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				writeSample(w, name+"_total", met, "", "", met.Counter.GetValue())
+			case dto.MetricType_GAUGE:
+				writeSample(w, name, met, "", "", met.Gauge.GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, q := range met.Summary.Quantile {
+					writeSample(w, name, met, "quantile", formatFloat(q.GetQuantile()), q.GetValue())
+				}
+				writeSample(w, name+"_sum", met, "", "", met.Summary.GetSampleSum())
+				writeSample(w, name+"_count", met, "", "", float64(met.Summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				infinite := false
+				for _, b := range met.Histogram.Bucket {
+					infinite = infinite || math.IsInf(b.GetUpperBound(), 1)
+					writeSample(w, name+"_bucket", met, "le", formatFloat(b.GetUpperBound()), float64(b.GetCumulativeCount()))
+				}
+				if !infinite {
+					writeSample(w, name+"_bucket", met, "le", "+Inf", float64(met.Histogram.GetSampleCount()))
+				}
+				writeSample(w, name+"_sum", met, "", "", met.Histogram.GetSampleSum())
+				writeSample(w, name+"_count", met, "", "", float64(met.Histogram.GetSampleCount()))
+			default:
+				writeSample(w, name, met, "", "", met.Untyped.GetValue())
+			}
+		}
+	}
+	w.WriteString("# EOF\n")
+	return w.Flush()
+}
+
+// writeSample writes one line, with an extra label such as a quantile when
+// extra is not empty. OpenMetrics timestamps are in seconds.
+func writeSample(w *bufio.Writer, name string, met *dto.Metric, extra, extraVal string, val float64) {
+	pairs := make([]string, 0, len(met.Label)+1)
+	for _, lp := range met.Label {
+		pairs = append(pairs, lp.GetName()+"=\""+labelEscaper.Replace(lp.GetValue())+"\"")
+	}
+	if extra != "" {
+		pairs = append(pairs, extra+"=\""+extraVal+"\"")
+	}
+	w.WriteString(name)
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(val))
+	if met.TimestampMs != nil {
+		w.WriteString(" " + strconv.FormatFloat(float64(met.GetTimestampMs())/1000, 'f', -1, 64))
+	}
+	w.WriteString("\n")
+}
+
+func formatFloat(val float64) string {
+	switch {
+	case math.IsInf(val, 1):
+		return "+Inf"
+	case math.IsInf(val, -1):
+		return "-Inf"
+	case math.IsNaN(val):
+		return "NaN"
+	}
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
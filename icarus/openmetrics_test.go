@@ -0,0 +1,97 @@
+package icarus
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]expfmt.Format{
+		"":                         expfmt.FmtText,
+		"text/plain;version=0.0.4": expfmt.FmtText,
+		"application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1": FmtOpenMetrics,
+		"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3":       expfmt.FmtProtoDelim,
+		"text/plain;q=0.9,application/openmetrics-text;q=0.5":                                                                                   expfmt.FmtText,
+		"application/json":                 expfmt.FmtText,
+		"application/openmetrics-text;q=0": expfmt.FmtText,
+	}
+	for accept, want := range cases {
+		if g := negotiate(http.Header{"Accept": []string{accept}}); g != want {
+			t.Errorf("%s: got %s", accept, g)
+		}
+	}
+}
+
+func scrape(i *Icarus, accept string) (string, string) {
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("Accept", accept)
+	i.HandleFunc(rw, r)
+	return rw.Header().Get("Content-Type"), rw.Body.String()
+}
+
+func TestFormats(t *testing.T) {
+	i := NewIcarus("ft_")
+	i.SetHelp(func(family string) string { return "help for " + family + "\nwith a \\ in it" })
+	i.SetTimestamps(true, 60)
+	i.Store.Insert(stamped("ft_high:cpu", "a", 2.5, 100))
+	i.Store.Insert(stamped("ft_high:cpu", "b", math.Inf(1), 100))
+	i.Store.Insert(stamped("ft_anomaly", "a", 1, 90))
+	i.rollup()
+
+	kind, text := scrape(i, "")
+	if kind != string(expfmt.FmtText) || !strings.Contains(text, "# HELP ft_high:cpu help for high:cpu\\nwith a \\\\ in it\n# TYPE ft_high:cpu gauge\n") {
+		t.Error(kind, text)
+	}
+
+	kind, om := scrape(i, "application/openmetrics-text; version=1.0.0")
+	if kind != string(FmtOpenMetrics) || !strings.HasSuffix(om, "# EOF\n") || strings.Count(om, "# EOF") != 1 {
+		t.Error(kind, om)
+	}
+	for _, want := range []string{
+		"# TYPE ft_high:cpu gauge\n# HELP ft_high:cpu help for high:cpu\\nwith a \\\\ in it\n" +
+			`ft_high:cpu{ft_pod="a"} 2.5 100` + "\n" + `ft_high:cpu{ft_pod="b"} +Inf 100` + "\n",
+		"# TYPE ft_anomaly gauge\n",
+		"# TYPE icarus_request_counter counter\n",
+		"\nicarus_request_counter_total ",
+		`icarus_return_metrics_summary{type="metrics",quantile="0.5"} `,
+	} {
+		if !strings.Contains(om, want) {
+			t.Error("openmetrics should have", want, "\n", om)
+		}
+	}
+
+	kind, raw := scrape(i, "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited")
+	if kind != string(expfmt.FmtProtoDelim) {
+		t.Error(kind)
+	}
+	dec := expfmt.NewDecoder(bytes.NewReader([]byte(raw)), expfmt.FmtProtoDelim)
+	found := 0
+	for {
+		var mf dto.MetricFamily
+		if err := dec.Decode(&mf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if mf.GetName() == "ft_high:cpu" {
+			found++
+			met := mf.Metric[0]
+			if mf.GetType() != dto.MetricType_GAUGE || mf.GetHelp() == "" || met.Gauge.GetValue() != 2.5 || met.GetTimestampMs() != 100000 {
+				t.Error(proto.CompactTextString(&mf))
+			}
+		}
+	}
+	if found != 1 {
+		t.Error("protobuf should have the generated family once", found)
+	}
+}
@@ -0,0 +1,236 @@
+package icarus
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/open-fresh/data-sidecar/prompb"
+	"github.com/open-fresh/data-sidecar/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// writeBackoff is how long a batch that may go through later waits before
+	// its first retry; it waits twice as long each time after.
+	writeBackoff = 250 * time.Millisecond
+	writeTimeout = 30 * time.Second
+
+	writeSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sidecar_remote_write_sent_samples_total",
+		Help: "Exported samples sent by remote write"})
+	writeDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_remote_write_dropped_samples_total",
+		Help: "Exported samples given up on before they were sent by remote write, by reason"},
+		[]string{"reason"})
+	writeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_remote_write_failures_total",
+		Help: "Failed remote write attempts, retried or not, by reason"},
+		[]string{"reason"})
+	writeQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sidecar_remote_write_queue_length",
+		Help: "Exported samples waiting to be sent by remote write"})
+)
+
+func init() {
+	prometheus.MustRegister(writeSent)
+	prometheus.MustRegister(writeDropped)
+	prometheus.MustRegister(writeFailures)
+	prometheus.MustRegister(writeQueued)
+}
+
+// queued is one exported sample waiting to be sent.
+type queued struct {
+	key    string
+	labels []*prompb.Label
+	sample prompb.Sample
+}
+
+// Writer sends exported metrics to a remote write endpoint with the time they
+// were scored at, so nothing is lost or shifted between scrapes. Samples wait
+// in a queue of bounded length and go out in batches, as soon as a batch is
+// full and otherwise once per deadline. When the queue is full the oldest
+// samples make way for new ones.
+type Writer struct {
+	*sync.Mutex
+	url      string
+	capacity int
+	batch    int
+	deadline time.Duration
+	retries  int
+	client   *http.Client
+	pending  []queued
+	wake     chan bool
+}
+
+// NewWriter returns a writer that sends nothing until it is given a url.
+func NewWriter() *Writer {
+	var mux sync.Mutex
+	client := &http.Client{Timeout: writeTimeout, Transport: util.PooledTransporter(1)}
+	return &Writer{&mux, "", 1, 1, time.Second, 0, client, make([]queued, 0), make(chan bool, 1)}
+}
+
+// Set points the writer at url, or turns it off when url is empty, which
+// drops whatever was still queued. Capacity bounds the queue, batch is the
+// most samples sent at once, deadline the longest a sample waits for its
+// batch to fill up, and retries how often a failed batch is tried again.
+func (w *Writer) Set(url string, capacity, batch int, deadline time.Duration, retries int) {
+	w.Lock()
+	defer w.Unlock()
+	w.url, w.capacity, w.batch, w.deadline, w.retries = url, capacity, batch, deadline, retries
+	if url == "" {
+		w.drop(len(w.pending), "disabled")
+	}
+	w.drop(len(w.pending)-capacity, "queue_full")
+}
+
+// drop forgets the n oldest queued samples. It expects the lock to be held.
+func (w *Writer) drop(n int, reason string) {
+	if n <= 0 {
+		return
+	}
+	writeDropped.WithLabelValues(reason).Add(float64(n))
+	w.pending = append(w.pending[:0], w.pending[n:]...)
+	writeQueued.Set(float64(len(w.pending)))
+}
+
+// Add queues a metric, named as it is exported, to be sent. Values that are
+// not numbers are left out, as they are from the exposition.
+func (w *Writer) Add(met util.Metric) {
+	if math.IsNaN(met.Data.Val) {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.url == "" {
+		return
+	}
+	w.drop(len(w.pending)+1-w.capacity, "queue_full")
+	w.pending = append(w.pending, queued{util.MapSSToS(met.Desc), writeLabels(met.Desc),
+		prompb.Sample{Value: met.Data.Val, Timestamp: met.Data.Time * 1000}})
+	writeQueued.Set(float64(len(w.pending)))
+	if len(w.pending) >= w.batch {
+		select {
+		case w.wake <- true:
+		default:
+		}
+	}
+}
+
+// writeLabels picks the labels of a metric that are exported, sorted by name.
+func writeLabels(desc map[string]string) []*prompb.Label {
+	out := make([]*prompb.Label, 0, len(desc))
+	for key, val := range desc {
+		if exported(key, val) || key == "__name__" {
+			out = append(out, &prompb.Label{Name: key, Value: val})
+		}
+	}
+	sort.Slice(out, func(ii, jj int) bool { return out[ii].Name < out[jj].Name })
+	return out
+}
+
+// Run sends batches for as long as the process lives.
+func (w *Writer) Run() {
+	for {
+		w.Lock()
+		deadline := w.deadline
+		w.Unlock()
+		select {
+		case <-w.wake:
+		case <-time.After(deadline):
+		}
+		for w.flush() {
+		}
+	}
+}
+
+// flush sends the oldest batch of queued samples and says whether there is
+// anything left to send.
+func (w *Writer) flush() bool {
+	w.Lock()
+	url, retries := w.url, w.retries
+	size := len(w.pending)
+	if size > w.batch {
+		size = w.batch
+	}
+	batch := append([]queued{}, w.pending[:size]...)
+	w.pending = append(w.pending[:0], w.pending[size:]...)
+	writeQueued.Set(float64(len(w.pending)))
+	w.Unlock()
+	if size == 0 || url == "" {
+		return false
+	}
+
+	body, err := proto.Marshal(writeRequest(batch))
+	if err != nil {
+		writeDropped.WithLabelValues("marshal").Add(float64(size))
+		return true
+	}
+	body = snappy.Encode(nil, body)
+	wait := writeBackoff
+	for tries := 0; ; tries++ {
+		reason, again := w.send(url, body)
+		if reason == "" {
+			writeSent.Add(float64(size))
+			break
+		}
+		writeFailures.WithLabelValues(reason).Inc()
+		if !again || tries >= retries {
+			writeDropped.WithLabelValues(reason).Add(float64(size))
+			break
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+	w.Lock()
+	defer w.Unlock()
+	return len(w.pending) > 0
+}
+
+// writeRequest gathers the samples of a batch into one series per label set,
+// keeping them in the order they were recorded.
+func writeRequest(batch []queued) *prompb.WriteRequest {
+	out := &prompb.WriteRequest{Timeseries: make([]*prompb.TimeSeries, 0)}
+	series := make(map[string]*prompb.TimeSeries)
+	for ii := range batch {
+		xx := &batch[ii]
+		ts, ok := series[xx.key]
+		if !ok {
+			ts = &prompb.TimeSeries{Labels: xx.labels}
+			series[xx.key] = ts
+			out.Timeseries = append(out.Timeseries, ts)
+		}
+		ts.Samples = append(ts.Samples, &xx.sample)
+	}
+	return out
+}
+
+// send posts one batch and returns why it failed, if it did, and whether
+// sending it again might help. Server side errors and throttling are worth
+// another try; anything else the endpoint refuses is not.
+func (w *Writer) send(url string, body []byte) (string, bool) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return "bad_request", false
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "unreachable", true
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	if code := resp.StatusCode; code/100 != 2 {
+		return fmt.Sprintf("http_%d", code), code >= 500 || code == http.StatusTooManyRequests
+	}
+	return "", false
+}
@@ -0,0 +1,131 @@
+package icarus
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/open-fresh/data-sidecar/prompb"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// fakeWrite is a remote write endpoint that answers with the codes it is
+// given, in turn, and keeps what it took.
+type fakeWrite struct {
+	sync.Mutex
+	codes []int
+	got   []*prompb.WriteRequest
+	tries int
+}
+
+func (f *fakeWrite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.tries++
+	if len(f.codes) > 0 {
+		code := f.codes[0]
+		f.codes = f.codes[1:]
+		if code != http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	raw, err := snappy.Decode(nil, body)
+	var req prompb.WriteRequest
+	if err != nil || proto.Unmarshal(raw, &req) != nil || r.Header.Get("Content-Encoding") != "snappy" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.got = append(f.got, &req)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func written(job string, val float64, at int64) util.Metric {
+	return util.Metric{Desc: map[string]string{"__name__": "ft_x", "job": job, "ft_target": "true", "G": ""}, Data: util.DataPoint{Val: val, Time: at}}
+}
+
+func TestWriter(t *testing.T) {
+	writeBackoff = time.Millisecond
+	fake := &fakeWrite{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	w := NewWriter()
+	w.Add(written("a", 1, 10))
+	if len(w.pending) != 0 {
+		t.Error("nothing should be queued without a url")
+	}
+	w.Set(server.URL, 4, 3, time.Hour, 2)
+	w.Add(written("a", 1, 10))
+	w.Add(written("b", 2, 10))
+	w.Add(written("a", 3, 20))
+	w.Add(written("a", 0, 30))
+	w.Add(written("a", 4, 40))
+	if len(w.pending) != 4 || w.pending[0].sample.Value != 2 {
+		t.Error("a full queue should drop the oldest", w.pending)
+	}
+	if !w.flush() || w.flush() {
+		t.Error("four samples should go out in two batches")
+	}
+	if len(fake.got) != 2 {
+		t.Fatal(fake.got)
+	}
+	first := fake.got[0].Timeseries
+	if len(first) != 2 || len(first[1].Samples) != 2 || first[1].Samples[0].Timestamp != 20000 {
+		t.Error("samples of a series should be sent together with their times in milliseconds", first)
+	}
+	labels := first[0].LabelMap()
+	if len(labels) != 2 || labels["__name__"] != "ft_x" || labels["job"] != "b" {
+		t.Error("labels should be exported as they are exposed", labels)
+	}
+
+	fake.codes = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent}
+	w.Add(written("a", 5, 50))
+	w.flush()
+	if len(fake.got) != 3 || fake.tries != 5 {
+		t.Error("throttling and server errors should be retried", fake.tries)
+	}
+	fake.codes = []int{http.StatusBadRequest}
+	w.Add(written("a", 6, 60))
+	w.flush()
+	if len(fake.got) != 3 || fake.tries != 6 {
+		t.Error("refused samples should not be retried", fake.tries)
+	}
+	fake.codes = []int{500, 500, 500}
+	w.Add(written("a", 7, 70))
+	w.flush()
+	if fake.tries != 9 || len(w.pending) != 0 {
+		t.Error("batches should be dropped once the retries run out", fake.tries)
+	}
+
+	w.Add(written("a", 8, 80))
+	w.Set("", 4, 3, time.Hour, 2)
+	if len(w.pending) != 0 {
+		t.Error("turning remote write off should drop the queue")
+	}
+}
+
+func TestIcarusWrites(t *testing.T) {
+	fake := &fakeWrite{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	i := NewIcarus("ft_")
+	i.SetRemoteWrite(server.URL, 10, 1, time.Hour, 0)
+	i.Record(helper(map[string]string{"__name__": "x", "a": "b"}, 1))
+	for ii := 0; ii < 100; ii++ {
+		fake.Lock()
+		done := len(fake.got) > 0
+		fake.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("a full batch should be sent straight away")
+}
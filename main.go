@@ -9,11 +9,15 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/open-fresh/data-sidecar/config"
 	"github.com/open-fresh/data-sidecar/icarus"
 	"github.com/open-fresh/data-sidecar/prom"
-	"github.com/open-fresh/data-sidecar/scoring"
 	"github.com/open-fresh/data-sidecar/storage"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -33,6 +37,7 @@ var (
 	// cheats and hacks
 	ticker   = Ticker
 	logFatal = log.Fatal
+	exit     = os.Exit
 	// flags
 
 	port       = flag.Int("port", 8077, "port on which to expose metrics")
@@ -41,10 +46,45 @@ var (
 	resolution = flag.Int("resolution", 10, "range query resolution (seconds)")
 	lookback   = flag.Int("lookback", 60, "empirical lookback window (minutes)")
 	prefix     = flag.String("pfx", "ft_", "export prefix for metrics")
+	timestamps = flag.Bool("exposition-timestamps", false, "expose metrics with the time of the point they were scored for")
+	ringLength = flag.Int("ring-length", storage.DefaultLength, "number of points kept per series")
+	configFile = flag.String("config", "", "yaml configuration file declaring target groups and their models")
+	checkDir   = flag.String("checkpoint-dir", "", "directory to checkpoint stored series to and restore them from, disabled when empty")
+	checkEvery = flag.Int("checkpoint-interval", 60, "time between checkpoints (seconds)")
+	checkAge   = flag.Int("checkpoint-max-age", 3600, "oldest checkpoint that will be restored on startup (seconds)")
+	workers    = flag.Int("query-workers", config.DefaultQueryWorkers, "number of range queries run at once")
+	timeout    = flag.Int("query-timeout", config.DefaultQueryTimeout, "time a single query may take (seconds)")
+	backfill   = flag.Int("max-backfill", config.DefaultMaxBackfill, "longest gap fetched again after prometheus was unreachable (seconds)")
+	tenantRate = flag.Float64("tenant-query-rate", 0, "queries sent a second for each tenant, unlimited when 0")
+	remoteRead = flag.String("remote-read", "", "prometheus remote read url to fetch plain selectors through, the query API when empty")
+	writeURL   = flag.String("remote-write", "", "remote write url to send every exported sample to as well, disabled when empty")
+	tokenFile  = flag.String("bearer-token-file", "", "file holding a bearer token sent to prometheus, read again when it changes")
+	caFile     = flag.String("ca-file", "", "CA certificate file used to check the certificate of prometheus")
+	certFile   = flag.String("cert-file", "", "client certificate file presented to prometheus")
+	keyFile    = flag.String("key-file", "", "key file of the client certificate")
+	selectors  = stringList{}
+	receives   = stringList{}
+	tenants    = stringList{}
 	version    = "undefined"
 )
 
+// stringList is a repeatable flag, holding PromQL selectors or tenants.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, " ")
+}
+
+// Set appends another value to the list.
+func (s *stringList) Set(val string) error {
+	*s = append(*s, val)
+	return nil
+}
+
 func init() {
+	flag.Var(&selectors, "selector", "PromQL series selector or expression to analyze, may be repeated (default {ft_target=\"true\"})")
+	flag.Var(&receives, "receive-selector", "plain PromQL selector matched against series pushed to /api/v1/write, may be repeated")
+	flag.Var(&tenants, "tenant", "tenant of a multi-tenant prometheus to analyze, sent as X-Scope-OrgID, may be repeated")
 	prometheus.MustRegister(attemptCounter)
 	prometheus.MustRegister(requestSummary)
 }
@@ -64,11 +104,97 @@ func Ticker(hh time.Duration) <-chan time.Time {
 	return hygeineTicker.C
 }
 
+// restoreCheckpoint loads whatever a previous run left behind. Anything wrong
+// with the snapshot is logged and the sidecar starts empty instead.
+func restoreCheckpoint(store *storage.Store, dir string, maxAge time.Duration) {
+	restored, err := store.Restore(dir, maxAge)
+	if err != nil {
+		attemptCounter.WithLabelValues("restoreFailure").Inc()
+		log.Println("not restoring checkpoint:", err)
+		return
+	}
+	attemptCounter.WithLabelValues("restoreSeries").Add(float64(restored))
+	log.Println("restored", restored, "series from", dir)
+}
+
+// checkpoint writes the store to disk on every tick, and once more when the
+// process is asked to stop.
+func checkpoint(store *storage.Store, dir string, tick <-chan time.Time) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	write := func() {
+		if err := store.Checkpoint(dir); err != nil {
+			attemptCounter.WithLabelValues("checkpointFailure").Inc()
+			log.Println("error writing checkpoint:", err)
+			return
+		}
+		attemptCounter.WithLabelValues("checkpoint").Inc()
+	}
+	for {
+		select {
+		case _, ok := <-tick:
+			if !ok {
+				return
+			}
+			write()
+		case <-stop:
+			write()
+			exit(0)
+		}
+	}
+}
+
+// loadConfig builds the configuration from the flags and, if one was given,
+// the configuration file on top of them.
+func loadConfig() (config.Config, error) {
+	sels := []string(selectors)
+	if len(sels) == 0 && len(receives) == 0 {
+		sels = []string{prom.DefaultSelector}
+	}
+	groups := make([]config.TargetGroup, 0)
+	if len(sels) > 0 {
+		groups = append(groups, config.TargetGroup{Name: "default", Selectors: sels})
+	}
+	if len(receives) > 0 {
+		groups = append(groups, config.TargetGroup{Name: "receive", Selectors: []string(receives), Receive: true})
+	}
+	cfg := config.Config{
+		Prometheus:   *p8s,
+		Resolution:   *resolution,
+		Lookback:     *lookback,
+		Cleanup:      *cleanup,
+		Prefix:       *prefix,
+		Timestamps:   *timestamps,
+		RingLength:   *ringLength,
+		QueryWorkers: *workers,
+		QueryTimeout: *timeout,
+		MaxBackfill:  *backfill,
+		RemoteRead:   *remoteRead,
+		RemoteWrite:  config.RemoteWrite{URL: *writeURL},
+		Groups:       groups,
+
+		BearerTokenFile: *tokenFile,
+		TLS:             config.TLSConfig{CAFile: *caFile, CertFile: *certFile, KeyFile: *keyFile},
+	}
+	for _, id := range tenants {
+		cfg.Tenants = append(cfg.Tenants, config.Tenant{ID: id, QueryRate: *tenantRate})
+	}
+	if *configFile == "" {
+		return config.Load([]byte{}, cfg)
+	}
+	return config.LoadFile(*configFile, cfg)
+}
+
 // main starts all the goroutines and web endpoints
 func main() {
 	// entire ecosystem of channels and tables.
 	flag.Parse()
 	log.Println("data sidecar version", version)
+	cfg, err := loadConfig()
+	if err != nil {
+		logFatal("invalid configuration: ", err)
+		return
+	}
 	mux := http.DefaultServeMux
 	log.Println("serving prometheus endpoints on port", *port)
 
@@ -77,20 +203,45 @@ func main() {
 	go func() { logFatal(server.ListenAndServe()) }()
 
 	seriesCollection := storage.NewStore()
+	seriesCollection.SetLengths(cfg.RingLength, cfg.LengthsBySelector())
+	if *checkDir != "" {
+		restoreCheckpoint(seriesCollection, *checkDir, time.Duration(*checkAge)*time.Second)
+		go checkpoint(seriesCollection, *checkDir, ticker(time.Duration(*checkEvery)*time.Second))
+	}
 
 	mux.HandleFunc("/dump", Monitor(seriesCollection.DumpHandleFunc))
-	remote := icarus.NewIcarus(*prefix)
+	remote := icarus.NewIcarus(cfg.Prefix)
+	configureExport(remote, cfg)
 	mux.HandleFunc("/metrics", Monitor(remote.HandleFunc))
-	scorer := scoring.NewScorer(seriesCollection, remote)
+	if err = clientAuth(cfg).Check(); err != nil {
+		logFatal("invalid prometheus credentials: ", err)
+		return
+	}
+	receiver := prom.NewReceiver()
+	receiver.SetStep(cfg.Resolution)
+	if err = receiver.SetSelectors(cfg.ReceiveSelectors()); err != nil {
+		logFatal("invalid configuration: ", err)
+		return
+	}
+	mux.HandleFunc("/api/v1/write", Monitor(receiver.HandleFunc))
+	running := make(map[string]*tenant)
+	for _, settings := range cfg.TenantList() {
+		started := newTenant(cfg, settings, seriesCollection, remote)
+		log.Println(started.client.Status())
+		started.client.Start()
+		receiver.SetScorer(settings.ID, started.scorer)
+		running[settings.ID] = started
+	}
 
-	mux.HandleFunc("/score", Monitor(scorer.ScoreHandleFunc))
+	reload := newReloader(cfg, loadConfig, running, seriesCollection, remote, receiver)
+	mux.HandleFunc("/score", Monitor(reload.ScoreHandleFunc))
+	reload.Watch()
+	mux.HandleFunc("/-/reload", Monitor(reload.HandleFunc))
 
-	promClient := prom.NewClient(*p8s, *resolution, *lookback, scorer)
-	log.Println(promClient.Status())
-	promClient.Start()
-	hygeineTicker := ticker(time.Duration(*cleanup)*time.Second + time.Microsecond)
+	hygeineTicker := ticker(time.Duration(cfg.Cleanup)*time.Second + time.Microsecond)
 	for range hygeineTicker {
-		removed := float64(len(seriesCollection.Prune(*cleanup)))
+		removed := float64(len(seriesCollection.Prune(reload.Config().Cleanup)))
 		attemptCounter.WithLabelValues("deleteSeries").Add(removed)
+		seriesCollection.ReportUsage()
 	}
 }
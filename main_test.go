@@ -1,13 +1,22 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/icarus"
+	"github.com/open-fresh/data-sidecar/prom"
+	"github.com/open-fresh/data-sidecar/storage"
 	"github.com/open-fresh/data-sidecar/util"
 )
 
@@ -57,3 +66,113 @@ func TestTicker(t *testing.T) {
 func TestMain(t *testing.T) {
 	main()
 }
+
+func TestReload(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewStore()
+	remote := icarus.NewIcarus(cfg.Prefix)
+	running := newTenant(cfg, config.Tenant{}, store, remote)
+	client := running.client
+	store.Add(map[string]string{util.SelectorLabel: prom.DefaultSelector}, 1, 1)
+
+	next := cfg
+	next.Groups = []config.TargetGroup{{Name: "other", Selectors: []string{`{job="a"}`}, Models: cfg.Groups[0].Models}}
+	var loadErr error
+	r := newReloader(cfg, func() (config.Config, error) { return next, loadErr }, map[string]*tenant{"": running}, store, remote, prom.NewReceiver())
+
+	loadErr = errors.New("bad file")
+	rw := httptest.NewRecorder()
+	r.HandleFunc(rw, httptest.NewRequest("POST", "/-/reload", nil))
+	if rw.Code != http.StatusInternalServerError || len(client.Selectors) != 1 || client.Selectors[0] != prom.DefaultSelector {
+		t.Error("failed reloads should keep the old configuration", rw.Code, client.Selectors)
+	}
+	if len(store.UsedKeys()) != 1 {
+		t.Error("failed reloads should keep state")
+	}
+
+	rw = httptest.NewRecorder()
+	r.HandleFunc(rw, httptest.NewRequest("GET", "/-/reload", nil))
+	if rw.Code != http.StatusMethodNotAllowed {
+		t.Error(rw.Code)
+	}
+
+	loadErr = nil
+	rw = httptest.NewRecorder()
+	r.HandleFunc(rw, httptest.NewRequest("POST", "/-/reload", nil))
+	if rw.Code != http.StatusOK || client.Selectors[0] != `{job="a"}` || r.Config().Groups[0].Name != "other" {
+		t.Error(rw.Code, client.Selectors)
+	}
+	if len(store.UsedKeys()) != 0 {
+		t.Error("series of dropped selectors should be forgotten")
+	}
+
+	store.Add(map[string]string{"__name__": "up"}, 1, 1)
+	next.Tenants = []config.Tenant{{ID: "team-a", QueryRate: 5}}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.tenants) != 1 || r.tenants["team-a"] == nil || !client.Stopped {
+		t.Error("tenants should replace the unnamed tenant", r.tenants)
+	}
+	if len(store.UsedKeys()) != 0 {
+		t.Error("series of the unnamed tenant should be forgotten with it")
+	}
+	if g := r.tenants["team-a"].client.Tenant(); g != "team-a" {
+		t.Error(g)
+	}
+	rw = httptest.NewRecorder()
+	r.ScoreHandleFunc(rw, httptest.NewRequest("GET", "/score?data=[1,2,3]", nil))
+	if rw.Code != http.StatusOK || !strings.HasPrefix(rw.Body.String(), "[") {
+		t.Error("scoring should go to the first tenant still running", rw.Code, rw.Body.String())
+	}
+	rw = httptest.NewRecorder()
+	r.ScoreHandleFunc(rw, httptest.NewRequest("GET", "/score?data=[1,2,3]&tenant=team-b", nil))
+	if rw.Code != http.StatusNotFound {
+		t.Error("unknown tenants cannot score", rw.Code)
+	}
+	store.Add(map[string]string{util.TenantLabel: "team-a"}, 1, 1)
+	next.Tenants = nil
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.UsedKeys()) != 0 || r.tenants["team-a"] != nil {
+		t.Error("series of dropped tenants should be forgotten")
+	}
+
+	next.Groups = []config.TargetGroup{{Name: "pushed", Selectors: []string{`{job="a"}`}, Receive: true, Models: cfg.Groups[0].Models}}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.tenants[""].client.Stopped {
+		t.Error("nothing is left to fetch when every group receives")
+	}
+	next.Groups[0].Selectors = []string{`sum(up)`}
+	if err := r.Reload(); err == nil {
+		t.Error("expressions cannot be received")
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sidecar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := storage.NewStore()
+	store.Add(map[string]string{"a": "b"}, 1, 1)
+	checkpoint(store, dir, overrideTicker(time.Second))
+
+	restored := storage.NewStore()
+	restoreCheckpoint(restored, dir, time.Hour)
+	if len(restored.UsedKeys()) != 1 {
+		t.Error("checkpoint did not round trip")
+	}
+	empty := storage.NewStore()
+	restoreCheckpoint(empty, filepath.Join(dir, "missing"), time.Hour)
+	if len(empty.UsedKeys()) != 0 {
+		t.Error("nothing should be restored from nowhere")
+	}
+}
@@ -0,0 +1,181 @@
+package prom
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Auth is how the client proves who it is to prometheus and how it checks who
+// prometheus is. At most one of basic auth and a bearer token is used. Secrets
+// kept in files are read again whenever the file changes, so rotating them
+// needs no restart.
+type Auth struct {
+	Username           string
+	Password           string
+	PasswordFile       string
+	BearerToken        string
+	BearerTokenFile    string
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Check reports whether the files auth refers to can be used.
+func (a Auth) Check() error {
+	if _, err := a.tlsConfig(); err != nil {
+		return err
+	}
+	for _, file := range []string{a.PasswordFile, a.BearerTokenFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := ioutil.ReadFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tlsConfig builds the TLS settings for auth, or nil when the defaults do.
+func (a Auth) tlsConfig() (*tls.Config, error) {
+	if a.CAFile == "" && a.CertFile == "" && a.ServerName == "" && !a.InsecureSkipVerify {
+		return nil, nil
+	}
+	out := &tls.Config{ServerName: a.ServerName, InsecureSkipVerify: a.InsecureSkipVerify}
+	if a.CAFile != "" {
+		pem, err := ioutil.ReadFile(a.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca_file: %v", err)
+		}
+		out.RootCAs = x509.NewCertPool()
+		if !out.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s holds no certificates", a.CAFile)
+		}
+	}
+	if a.CertFile != "" || a.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(a.CertFile, a.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %v", err)
+		}
+		out.Certificates = []tls.Certificate{cert}
+	}
+	return out, nil
+}
+
+// secretFile is a secret kept in a file, read again whenever the file changes.
+type secretFile struct {
+	*sync.Mutex
+	path   string
+	mod    time.Time
+	secret string
+}
+
+func newSecretFile(path string) *secretFile {
+	var mux sync.Mutex
+	return &secretFile{&mux, path, time.Time{}, ""}
+}
+
+// read returns the secret, reading the file again if it changed since last time.
+func (s *secretFile) read() (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", err
+	}
+	if !info.ModTime().Equal(s.mod) {
+		in, err := ioutil.ReadFile(s.path)
+		if err != nil {
+			return "", err
+		}
+		s.secret = strings.TrimSpace(string(in))
+		s.mod = info.ModTime()
+	}
+	return s.secret, nil
+}
+
+// credentials are the parts of auth added to every request.
+type credentials struct {
+	auth     Auth
+	password *secretFile
+	token    *secretFile
+}
+
+func newCredentials(auth Auth) *credentials {
+	out := &credentials{auth: auth}
+	if auth.PasswordFile != "" {
+		out.password = newSecretFile(auth.PasswordFile)
+	}
+	if auth.BearerTokenFile != "" {
+		out.token = newSecretFile(auth.BearerTokenFile)
+	}
+	return out
+}
+
+// authorize adds the credentials to a request.
+func (c *credentials) authorize(req *http.Request) error {
+	if c.auth.Username != "" {
+		password := c.auth.Password
+		if c.password != nil {
+			var err error
+			if password, err = c.password.read(); err != nil {
+				return &queryError{"auth_file", false, err}
+			}
+		}
+		req.SetBasicAuth(c.auth.Username, password)
+		return nil
+	}
+	token := c.auth.BearerToken
+	if c.token != nil {
+		var err error
+		if token, err = c.token.read(); err != nil {
+			return &queryError{"auth_file", false, err}
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// SetAuth makes the client authenticate to prometheus and check its identity
+// as auth says. When the TLS settings cannot be loaded the client is left as
+// it was.
+func (c *Client) SetAuth(auth Auth) error {
+	tlsConfig, err := auth.tlsConfig()
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.creds = newCredentials(auth)
+	c.tls = tlsConfig
+	c.client, _ = httpClient(c.workers, c.timeout, c.tls)
+	return nil
+}
+
+// getCredentials returns the credentials requests carry.
+func (c *Client) getCredentials() *credentials {
+	c.Lock()
+	defer c.Unlock()
+	return c.creds
+}
+
+// tlsFailure reports whether a request failed because prometheus could not be
+// trusted, which trying again will not fix.
+func tlsFailure(err error) bool {
+	var authority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return errors.As(err, &authority) || errors.As(err, &hostname) || errors.As(err, &invalid)
+}
@@ -0,0 +1,104 @@
+package prom
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	ioutil.WriteFile(tokenFile, []byte("first\n"), 0600)
+
+	var seen string
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		seen = r.Header.Get("Authorization")
+		if user, password, ok := r.BasicAuth(); ok && (user != "a" || password != "b") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"Status":"success"}`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, nil, 10, 60, nil)
+	if err := c.SetAuth(Auth{BearerTokenFile: tokenFile}); err != nil {
+		t.Fatal(err)
+	}
+	c.Fetch(server.URL)
+	if seen != "Bearer first" {
+		t.Error(seen)
+	}
+	ioutil.WriteFile(tokenFile, []byte("second"), 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(tokenFile, later, later)
+	c.Fetch(server.URL)
+	if seen != "Bearer second" {
+		t.Error("a rotated token should be read again", seen)
+	}
+	os.Remove(tokenFile)
+	if _, err := c.Fetch(server.URL); err == nil || err.(*queryError).reason != "auth_file" {
+		t.Error("a missing token file is an auth failure", err)
+	}
+
+	c.SetAuth(Auth{Username: "a", Password: "wrong"})
+	calls = 0
+	_, err = c.fetchRetry(server.URL, "x")
+	if qe, ok := err.(*queryError); !ok || qe.reason != "auth_401" || calls != 1 {
+		t.Error("refused credentials should be told apart and not retried", err, calls)
+	}
+	c.SetAuth(Auth{Username: "a", Password: "b"})
+	if _, err := c.Fetch(server.URL); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Status":"success"}`)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	c := NewClient(server.URL, nil, 10, 60, nil)
+	_, err = c.fetchRetry(server.URL, "x")
+	if qe, ok := err.(*queryError); !ok || qe.reason != "tls" {
+		t.Error("an untrusted prometheus is not a network error", err)
+	}
+	if err := c.SetAuth(Auth{CAFile: caFile}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Fetch(server.URL); err != nil {
+		t.Error(err)
+	}
+
+	missing := Auth{CAFile: filepath.Join(dir, "missing.pem")}
+	if missing.Check() == nil || c.SetAuth(missing) == nil {
+		t.Error("a missing ca_file should be reported")
+	}
+	if _, err := c.Fetch(server.URL); err != nil {
+		t.Error("a failed SetAuth should leave the client alone", err)
+	}
+	if (Auth{CAFile: filepath.Join(dir, "ca.pem"), CertFile: caFile}).Check() == nil {
+		t.Error("a certificate without its key should be reported")
+	}
+}
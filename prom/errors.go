@@ -0,0 +1,167 @@
+package prom
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// queryRetries is how many times a query that may succeed later is retried,
+	// waiting retryBackoff before the first retry and twice as long each time after.
+	queryRetries = 3
+	retryBackoff = 250 * time.Millisecond
+
+	queryFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_query_failures_total",
+		Help: "Number of failed query attempts, retried or not, by reason and metric"},
+		[]string{"reason", "metric"})
+)
+
+func init() {
+	prometheus.MustRegister(queryFailures)
+}
+
+// queryError is a query that failed, with the reason it is counted under and
+// whether trying again might help.
+type queryError struct {
+	reason string
+	retry  bool
+	err    error
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.reason, e.err)
+}
+
+// Unwrap gives the failure behind e, so errors.Is still finds errProm in what
+// prometheus answered.
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
+// apiStatus is the part of every prometheus API response that says whether it worked.
+type apiStatus struct {
+	Status    string
+	ErrorType string
+	Error     string
+}
+
+// checkResponse turns a response prometheus did not answer successfully into
+// an error. Errors prometheus explains in the body keep its explanation;
+// refused credentials are told apart from other failures, and overloaded
+// servers and server side errors are worth retrying.
+func checkResponse(code int, body []byte) error {
+	if code == http.StatusUnauthorized || code == http.StatusForbidden {
+		return &queryError{fmt.Sprintf("auth_%d", code), false, fmt.Errorf("%w: %s", errProm, http.StatusText(code))}
+	}
+	var status apiStatus
+	json.Unmarshal(body, &status)
+	if strings.EqualFold(status.Status, "error") {
+		if status.ErrorType == "" {
+			status.ErrorType = "error"
+		}
+		retry := status.ErrorType == "timeout" || status.ErrorType == "internal" || status.ErrorType == "unavailable"
+		return &queryError{"prometheus_" + status.ErrorType, retry, fmt.Errorf("%w: %s", errProm, status.Error)}
+	}
+	if code/100 != 2 {
+		retry := code >= 500 || code == http.StatusTooManyRequests
+		return &queryError{fmt.Sprintf("http_%d", code), retry, fmt.Errorf("%w: %s", errProm, http.StatusText(code))}
+	}
+	return nil
+}
+
+// promqlWords are the PromQL keywords and aggregations that can stand where a
+// metric name could, and so are never taken for one. Those that are true are
+// followed by a list of label names, which are not metrics either.
+var promqlWords = map[string]bool{
+	"by": true, "without": true, "on": true, "ignoring": true, "group_left": true, "group_right": true,
+	"bool": false, "offset": false, "and": false, "or": false, "unless": false, "inf": false, "nan": false,
+	"sum": false, "min": false, "max": false, "avg": false, "group": false, "stddev": false, "stdvar": false,
+	"count": false, "count_values": false, "bottomk": false, "topk": false, "quantile": false,
+}
+
+// queryMetric names the metric a query is about for the failure metrics: the
+// first metric name in it, or "expression" when it names none, so the label
+// never holds a whole query.
+func queryMetric(query string) string {
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '{' || ch == '[':
+			depth++
+		case ch == '}' || ch == ']':
+			depth--
+		case ch == '"' || ch == '\'' || ch == '`':
+			if end := strings.IndexByte(query[i+1:], ch); end >= 0 {
+				i += end + 1
+			}
+		case depth > 0:
+		case isNameChar(ch, false):
+			end := i + 1
+			for end < len(query) && isNameChar(query[end], true) {
+				end++
+			}
+			word, rest := query[i:end], strings.TrimLeft(query[end:], " ")
+			labels, keyword := promqlWords[strings.ToLower(word)]
+			if !keyword && !strings.HasPrefix(rest, "(") {
+				return word
+			}
+			i = end - 1
+			if close := strings.Index(rest, ")"); labels && strings.HasPrefix(rest, "(") && close >= 0 {
+				i = len(query) - len(rest) + close
+			}
+		case ch >= '0' && ch <= '9' || ch == '.':
+			// A number or a duration, such as 1e3, 0x1f or 5m, names nothing.
+			for i+1 < len(query) && isNameChar(query[i+1], true) {
+				i++
+			}
+		}
+	}
+	return "expression"
+}
+
+// isNameChar is whether ch can be part of a metric name, and start one unless
+// it is a digit.
+func isNameChar(ch byte, digits bool) bool {
+	return ch == '_' || ch == ':' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || digits && ch >= '0' && ch <= '9'
+}
+
+// fetchRetry fetches endpt for the query about metric, retrying failures that
+// may go away.
+func (c *Client) fetchRetry(endpt, metric string) ([]byte, error) {
+	var body []byte
+	err := retry(metric, func() (err error) {
+		body, err = c.Fetch(endpt)
+		return
+	})
+	return body, err
+}
+
+// retry makes an attempt at the query about metric, trying again with
+// exponential backoff while it fails in ways that may go away. Every failed
+// attempt is counted.
+func retry(metric string, attempt func() error) error {
+	wait := retryBackoff
+	for tries := 0; ; tries++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		reason, again := "unreachable", true
+		if qe, ok := err.(*queryError); ok {
+			reason, again = qe.reason, qe.retry
+		}
+		queryFailures.WithLabelValues(reason, metric).Inc()
+		if !again || tries >= queryRetries {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
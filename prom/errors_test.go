@@ -0,0 +1,123 @@
+package prom
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCheckResponse(t *testing.T) {
+	cases := []struct {
+		code   int
+		body   string
+		reason string
+		retry  bool
+	}{
+		{200, `{"status":"success","data":{}}`, "", false},
+		{200, `{"Status":"ok"}`, "", false},
+		{400, `{"status":"error","errorType":"bad_data","error":"parse error"}`, "prometheus_bad_data", false},
+		{503, `{"status":"error","errorType":"unavailable","error":"shutting down"}`, "prometheus_unavailable", true},
+		{200, `{"status":"error"}`, "prometheus_error", false},
+		{502, `<html>bad gateway</html>`, "http_502", true},
+		{429, ``, "http_429", true},
+		{404, `not found`, "http_404", false},
+	}
+	for _, c := range cases {
+		err := checkResponse(c.code, []byte(c.body))
+		if c.reason == "" {
+			if err != nil {
+				t.Error(c.code, c.body, err)
+			}
+			continue
+		}
+		qe, ok := err.(*queryError)
+		if !ok || qe.reason != c.reason || qe.retry != c.retry {
+			t.Error(c.code, c.body, err)
+		}
+	}
+	err := checkResponse(400, []byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+	if !strings.Contains(err.Error(), "parse error") {
+		t.Error("prometheus' explanation should be kept", err)
+	}
+	if !errors.Is(err, errProm) {
+		t.Error("failures prometheus reports should be errProm", err)
+	}
+}
+
+func TestQueryMetric(t *testing.T) {
+	cases := map[string]string{
+		`up{job="a"}`:             "up",
+		`{job="a"}`:               "expression",
+		`rate(up{job="a"}[5m])`:   "up",
+		`container_memory_bytes`:  "container_memory_bytes",
+		`sum by (a) (x{job="b"})`: "x",
+		`sum(rate(http_requests_total{code=~"5.."}[5m] offset 1h)) without (instance) / 1e3`: "http_requests_total",
+		`topk(5, count_values("v", node_uname_info))`:                                        "node_uname_info",
+		`vector(1) > bool 0.5`:      "expression",
+		`max_over_time(up[1m:10s])`: "up",
+		`{__name__="up", job="}"}`:  "expression",
+	}
+	for in, want := range cases {
+		if got := queryMetric(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestFetchRetry(t *testing.T) {
+	var calls int32
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		call := atomic.AddInt32(&calls, 1)
+		switch r.FormValue("query") {
+		case "flaky":
+			if call < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"q":%q},"values":[[1,"1"]]}]}}`, r.FormValue("query"))
+	})
+	server := httptest.NewServer(serveMux)
+	defer server.Close()
+	failures := func(reason, metric string) float64 {
+		var m dto.Metric
+		queryFailures.WithLabelValues(reason, metric).(prometheus.Metric).Write(&m)
+		return m.GetCounter().GetValue()
+	}
+
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient(server.URL, []string{"flaky"}, 10, 60, &sc)
+	if _, err := c.fetchRetry(c.RangeQuery("flaky"), "flaky"); err != nil || calls != 3 {
+		t.Error("should have got through on the third try", err, calls)
+	}
+	if failures("http_503", "flaky") != 2 {
+		t.Error(failures("http_503", "flaky"))
+	}
+
+	calls = 0
+	if _, err := c.fetchRetry(c.RangeQuery("bad"), "bad"); err == nil || calls != 1 {
+		t.Error("a bad query is not worth retrying", err, calls)
+	}
+
+	// one bad query does not cost the others
+	c.Reload(server.URL, []string{"bad", "good", "also_good"}, 10, 60)
+	if found := c.RangeBatch(); found != 2 {
+		t.Error(found)
+	}
+	if failures("prometheus_bad_data", "bad") != 2 {
+		t.Error(failures("prometheus_bad_data", "bad"))
+	}
+}
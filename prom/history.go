@@ -0,0 +1,236 @@
+package prom
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+const (
+	// historyChunk is how much history one range query fetches. Models asking
+	// about neighbouring times are served from the same chunk.
+	historyChunk = 3600
+	// historyExpiry is how long a chunk is kept after it was last used.
+	historyExpiry = 2 * time.Hour
+)
+
+// historyEntry is one fetched chunk of history, complete up to until.
+type historyEntry struct {
+	series []util.Series
+	until  int64
+	used   time.Time
+}
+
+// historyQuery rebuilds a query that returns the series with these labels. A
+// series with a name is selected exactly; anything else came out of an
+// expression, which is queried again as written. The tenant label is ours
+// only when the series was fetched for a tenant.
+func historyQuery(labels map[string]string, tenant string) string {
+	name, ok := labels["__name__"]
+	if !ok {
+		return labels[util.SelectorLabel]
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		if key == "__name__" || key == util.SelectorLabel || (tenant != "" && key == util.TenantLabel) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	matchers := make([]string, len(keys))
+	for ii, key := range keys {
+		matchers[ii] = fmt.Sprintf("%s=%q", key, labels[key])
+	}
+	return name + "{" + strings.Join(matchers, ",") + "}"
+}
+
+// sameSeries reports whether a fetched series is the one labels describe.
+func sameSeries(fetched, labels map[string]string, tenant string) bool {
+	count := 0
+	for key, val := range labels {
+		if key == util.SelectorLabel || (tenant != "" && key == util.TenantLabel) {
+			continue
+		}
+		if fetched[key] != val {
+			return false
+		}
+		count++
+	}
+	return count == len(fetched)
+}
+
+// History returns the points a series had between start and end. Fetched
+// history is cached in chunks, so asking about the same stretch of time again
+// does not query prometheus again.
+func (c *Client) History(labels map[string]string, start, end int64) ([]util.DataPoint, error) {
+	c.Lock()
+	tenant := c.tenant
+	c.Unlock()
+	query := historyQuery(labels, tenant)
+	out := make([]util.DataPoint, 0)
+	for chunk := start - start%historyChunk; chunk <= end; chunk += historyChunk {
+		series, err := c.historyChunk(query, chunk, end)
+		if err != nil {
+			return out, err
+		}
+		for _, xx := range series {
+			if !sameSeries(xx.Labels, labels, tenant) {
+				continue
+			}
+			for _, yy := range xx.Data {
+				if yy.Time >= start && yy.Time <= end {
+					out = append(out, yy)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// historyChunk fetches the chunk of history starting at chunk, or takes it
+// from the cache. A chunk reaching into the present is fetched up to now and
+// kept too; once it is asked about later times, only the steps it is missing
+// are fetched and added to it.
+func (c *Client) historyChunk(query string, chunk, end int64) ([]util.Series, error) {
+	key := fmt.Sprintf("%d %s", chunk, query)
+	last := chunk + historyChunk - 1
+	if end > last {
+		end = last
+	}
+	c.Lock()
+	entry, ok := c.history[key]
+	if ok {
+		entry.used = time.Now()
+		if entry.until >= end {
+			c.Unlock()
+			return entry.series, nil
+		}
+	}
+	res := int64(c.Res)
+	c.Unlock()
+
+	to := last
+	if now := c.now(); now < to {
+		to = now
+	}
+	if to < end {
+		to = end
+	}
+	from := chunk
+	if ok {
+		// carry on from the step after the last one fetched
+		from = entry.until - (entry.until-chunk)%res + res
+	}
+	tail := make([]util.Series, 0)
+	if from <= to {
+		resp, err := c.Fetch(c.rangeURL(query, from, to, int(res)))
+		if err != nil {
+			errorCounter.WithLabelValues("history query error").Inc()
+			return nil, err
+		}
+		result, err := DecodeRangeQ(resp)
+		if err != nil {
+			return nil, err
+		}
+		tail = result.Series()
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if entry, ok = c.history[key]; ok {
+		// another caller may have fetched some of the tail in the meantime
+		if entry.until < to {
+			entry.series, entry.until = extend(entry.series, tail, entry.until), to
+		}
+		return entry.series, nil
+	}
+	c.remember(key, &historyEntry{series: tail, until: to})
+	return tail, nil
+}
+
+// extend returns series with the points of tail that are newer than until
+// added, series by series. The slices it was given are left alone, as callers
+// may still be reading them.
+func extend(series, tail []util.Series, until int64) []util.Series {
+	out := append([]util.Series{}, series...)
+	index := make(map[string]int, len(out))
+	for ii := range out {
+		index[util.MapSSToS(out[ii].Labels)] = ii
+	}
+	for _, xx := range tail {
+		data := make([]util.DataPoint, 0, len(xx.Data))
+		for _, yy := range xx.Data {
+			if yy.Time > until {
+				data = append(data, yy)
+			}
+		}
+		ii, ok := index[util.MapSSToS(xx.Labels)]
+		if !ok {
+			index[util.MapSSToS(xx.Labels)] = len(out)
+			out = append(out, util.Series{Labels: xx.Labels, Data: data})
+			continue
+		}
+		have := out[ii].Data
+		out[ii].Data = append(have[:len(have):len(have)], data...)
+	}
+	return out
+}
+
+// Evaluate returns what an expression evaluates to at a time, as the latest
+// point of each series it gives within one step before that time. Results are
+// cached for the step, so many series asking about the same expression in one
+// cycle only query prometheus once.
+func (c *Client) Evaluate(query string, at int64) ([]util.Series, error) {
+	c.Lock()
+	res := int64(c.Res)
+	c.Unlock()
+	at -= at % res
+	key := fmt.Sprintf("evaluate %d %s", at, query)
+	c.Lock()
+	if entry, ok := c.history[key]; ok {
+		entry.used = time.Now()
+		c.Unlock()
+		return entry.series, nil
+	}
+	c.Unlock()
+
+	resp, err := c.Fetch(c.rangeURL(query, at-res, at, int(res)))
+	if err != nil {
+		errorCounter.WithLabelValues("evaluate query error").Inc()
+		return nil, err
+	}
+	result, err := DecodeRangeQ(resp)
+	if err != nil {
+		return nil, err
+	}
+	if result.Status != "success" {
+		return nil, errProm
+	}
+	series := result.Series()
+	for ii := range series {
+		if len(series[ii].Data) > 0 {
+			series[ii].Data = series[ii].Data[len(series[ii].Data)-1:]
+		}
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.remember(key, &historyEntry{series: series})
+	return series, nil
+}
+
+// remember caches an entry under key, expiring whatever was not used in a
+// while. It expects the lock to be held.
+func (c *Client) remember(key string, entry *historyEntry) {
+	entry.used = time.Now()
+	for old, entry := range c.history {
+		if time.Since(entry.used) > historyExpiry {
+			delete(c.history, old)
+		}
+	}
+	c.history[key] = entry
+	internalDataSummary.WithLabelValues("history").Observe(float64(len(c.history)))
+}
@@ -0,0 +1,129 @@
+package prom
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+func TestHistoryQuery(t *testing.T) {
+	g := historyQuery(map[string]string{"__name__": "up", "job": "a", "instance": "b", util.SelectorLabel: "{}"}, "")
+	if g != `up{instance="b",job="a"}` {
+		t.Error(g)
+	}
+	g = historyQuery(map[string]string{"job": "a", util.SelectorLabel: "sum(rate(x[5m])) by (job)"}, "")
+	if g != "sum(rate(x[5m])) by (job)" {
+		t.Error(g)
+	}
+	if !sameSeries(map[string]string{"job": "a"}, map[string]string{"job": "a", util.SelectorLabel: "x"}, "") {
+		t.Error("the selector label is ours, not prometheus'")
+	}
+	if sameSeries(map[string]string{"job": "a", "x": "y"}, map[string]string{"job": "a"}, "") {
+		t.Error("extra labels make another series")
+	}
+	own := map[string]string{"__name__": "up", util.TenantLabel: "b"}
+	if g := historyQuery(own, ""); g != `up{ft_tenant="b"}` || sameSeries(map[string]string{"__name__": "up"}, own, "") {
+		t.Error("without tenants a tenant label belongs to the series", g)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	queries := 0
+	start := ""
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		start = r.FormValue("start")
+		fmt.Fprintf(w, `{"Status":"success","Data":{"ResultType":"matrix","Result":[
+			{"Metric":{"job":"a"},"Values":[[%[1]s,"1"],[%[2]s,"2"]]},
+			{"Metric":{"job":"b"},"Values":[[%[1]s,"3"]]}]}}`, r.FormValue("start"), r.FormValue("end"))
+	})
+	server := httptest.NewServer(serveMux)
+	defer server.Close()
+
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient(server.URL, []string{"sum(x)by(job)"}, 10, 60, &sc)
+	now := int64(1000*historyChunk + 1234)
+	c.now = func() int64 { return now }
+	labels := map[string]string{"job": "a", util.SelectorLabel: "sum(x)by(job)"}
+
+	past := (now/historyChunk - 48) * historyChunk
+	got, err := c.History(labels, past, past+historyChunk-1)
+	if err != nil || len(got) != 2 || got[0].Val != 1 || got[1].Time != past+historyChunk-1 {
+		t.Error(got, err)
+	}
+	c.History(labels, past+10, past+20)
+	c.History(map[string]string{"job": "b", util.SelectorLabel: "sum(x)by(job)"}, past, past+20)
+	if queries != 1 {
+		t.Error("history should come from the cache", queries)
+	}
+	got, _ = c.History(labels, past, past+historyChunk)
+	if queries != 2 || len(got) != 3 {
+		t.Error("a second chunk needs a second query", queries, got)
+	}
+
+	got, _ = c.History(labels, now-10, now)
+	c.History(labels, now-10, now)
+	if queries != 3 || len(got) != 1 || got[0].Time != now {
+		t.Error("the open chunk should be kept for the cycle", queries, got)
+	}
+	got, _ = c.History(labels, now-now%historyChunk, now+25)
+	if queries != 4 || start != fmt.Sprint(now-now%10+10) || len(got) != 4 || got[3].Time != now+25 {
+		t.Error("only the tail of the open chunk should be fetched again", queries, start, got)
+	}
+	open, fetched := now-now%historyChunk, now+25
+	now = open + historyChunk + 5
+	got, _ = c.History(labels, open, open+historyChunk-1)
+	if queries != 5 || start != fmt.Sprint(fetched-fetched%10+10) || got[len(got)-1].Time != open+historyChunk-1 {
+		t.Error("a chunk that closed should be fetched to its end", queries, start, got)
+	}
+	c.History(labels, open, open+historyChunk-1)
+	if queries != 5 {
+		t.Error("a closed chunk should come from the cache", queries)
+	}
+
+	c.P8s = "http://localhost:0"
+	if _, err := c.History(labels, past-historyChunk, past-1); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	queries := 0
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		if r.FormValue("query") == "broken" {
+			fmt.Fprint(w, `{"Status":"error"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"Status":"success","Data":{"ResultType":"matrix","Result":[
+			{"Metric":{"device":"a"},"Values":[[%[1]s,"1"],[%[2]s,"2"]]}]}}`, r.FormValue("start"), r.FormValue("end"))
+	})
+	server := httptest.NewServer(serveMux)
+	defer server.Close()
+
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient(server.URL, nil, 10, 60, &sc)
+	now := time.Now().Unix()
+	got, err := c.Evaluate("limit", now)
+	if err != nil || len(got) != 1 || len(got[0].Data) != 1 || got[0].Data[0].Val != 2 || got[0].Labels["device"] != "a" {
+		t.Error(got, err)
+	}
+	c.Evaluate("limit", now-now%10+9)
+	if queries != 1 {
+		t.Error("the same step should come from the cache", queries)
+	}
+	c.Evaluate("limit", now-now%10+10)
+	if queries != 2 {
+		t.Error("the next step needs another query", queries)
+	}
+	if _, err := c.Evaluate("broken", now); !errors.Is(err, errProm) {
+		t.Error(err)
+	}
+}
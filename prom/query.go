@@ -1,20 +1,30 @@
 package prom
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/open-fresh/data-sidecar/util"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-const scopeOrgIDHeader = "X-Scope-OrgID"
+const (
+	scopeOrgIDHeader = "X-Scope-OrgID"
+	// DefaultSelector is what the sidecar analyzes when nothing else is asked for.
+	DefaultSelector = `{ft_target="true"}`
+)
 
 var (
 	//errors
@@ -33,20 +43,42 @@ var (
 		Help: "How long are range queries taking?",
 	},
 		[]string{"type"})
+	cycleDuration = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name: "sidecar_cycle_duration_seconds",
+		Help: "How long a cycle of fetching and scoring takes"})
+	cycleOverruns = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sidecar_cycle_overruns_total",
+		Help: "Number of cycles that took longer than the resolution, skipping the next one"})
+	backfillTruncated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sidecar_backfill_truncated_seconds_total",
+		Help: "Seconds of missed data given up on because the gap was longer than the maximum backfill"})
 )
 
 // Client queries prometheus.
 type Client struct {
 	*sync.Mutex
-	Store    util.ScoringEngine
-	P8s      string
-	Res      int
-	Lookback int
-	start    int
-	end      int
-	client   *http.Client
-	series   map[string]bool
-	Stopped  bool
+	Store     util.ScoringEngine
+	P8s       string
+	Selectors []string
+	Res       int
+	Lookback  int
+	end       int
+	marks     map[string]int
+	backfill  int
+	client    *http.Client
+	workers   int
+	timeout   time.Duration
+	tenant    string
+	limit     *limiter
+	creds     *credentials
+	tls       *tls.Config
+	post      bool
+	remote    string
+	series    map[string]map[string]bool
+	history   map[string]*historyEntry
+	now       func() int64
+	done      chan bool
+	Stopped   bool
 }
 
 // RangeQ represents a range query
@@ -71,43 +103,262 @@ func init() {
 	prometheus.MustRegister(errorCounter)
 	prometheus.MustRegister(internalDataSummary)
 	prometheus.MustRegister(queryDurationsSummary)
+	prometheus.MustRegister(cycleDuration)
+	prometheus.MustRegister(cycleOverruns)
+	prometheus.MustRegister(backfillTruncated)
+}
+
+// unixNow is the clock clients tell which history is still open by.
+func unixNow() int64 {
+	return time.Now().Unix()
 }
 
-// NewClient builds a prometheus client.
-func NewClient(p8s string, res, lbk int, store util.ScoringEngine) *Client {
+// NewClient builds a prometheus client. Every selector is fetched and scored
+// independently; with no selectors the client falls back to DefaultSelector.
+// It runs one query at a time until told otherwise with SetPool, and backfills
+// gaps of up to defaultBackfill until told otherwise with SetBackfill.
+func NewClient(p8s string, selectors []string, res, lbk int, store util.ScoringEngine) *Client {
 	var mux sync.Mutex
-	client, _ := httpClient()
-	start := int(time.Now().Unix()) - lbk*60
+	client, _ := httpClient(1, defaultTimeout, nil)
 	end := int(time.Now().Unix())
-	return &Client{&mux, store, p8s, res, lbk, start, end, client, make(map[string]bool), false}
+	if len(selectors) == 0 {
+		selectors = []string{DefaultSelector}
+	}
+	return &Client{&mux, store, p8s, selectors, res, lbk, end, make(map[string]int), defaultBackfill,
+		client, 1, defaultTimeout, "", newLimiter(0), newCredentials(Auth{}), nil, true, "", make(map[string]map[string]bool), make(map[string]*historyEntry), unixNow, make(chan bool), false}
+}
+
+// SetBackfill sets the longest gap, in seconds, that is fetched again once a
+// query works after failing for a while.
+func (c *Client) SetBackfill(seconds int) {
+	c.Lock()
+	defer c.Unlock()
+	c.backfill = seconds
+}
+
+// window returns the stretch of time to fetch for a query: from where its last
+// successful fetch ended up to the end of this cycle. A query never fetched
+// before reaches back over the full lookback. A gap left by failed fetches is
+// filled in, but no further back than the backfill limit; the rest is given
+// up on for good.
+func (c *Client) window(key string) (start, end int) {
+	c.Lock()
+	defer c.Unlock()
+	end = c.end
+	start, ok := c.marks[key]
+	if !ok {
+		return end - c.Lookback*60, end
+	}
+	if end-start > c.backfill {
+		backfillTruncated.Add(float64(end - c.backfill - start))
+		start = end - c.backfill
+		c.marks[key] = start
+	}
+	return start, end
+}
+
+// advance records that a query fetched everything up to the end of this cycle.
+func (c *Client) advance(key string) {
+	c.Lock()
+	defer c.Unlock()
+	c.marks[key] = c.end
+}
+
+// pruneMarks forgets the high-water marks of queries that are no longer run.
+func (c *Client) pruneMarks() {
+	keys := make(map[string]bool)
+	for _, selector := range c.selectors() {
+		keys[selector] = true
+		for _, query := range c.rangeQueries(selector) {
+			keys[query] = true
+		}
+	}
+	c.Lock()
+	defer c.Unlock()
+	for key := range c.marks {
+		if !keys[key] {
+			delete(c.marks, key)
+		}
+	}
+}
+
+// SetPool sets how many range queries run at once and how long each may take.
+func (c *Client) SetPool(workers int, timeout time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	if workers < 1 {
+		workers = 1
+	}
+	if workers == c.workers && timeout == c.timeout {
+		return
+	}
+	c.workers = workers
+	c.timeout = timeout
+	c.client, _ = httpClient(workers, timeout, c.tls)
+}
+
+// pool returns how many queries run at once.
+func (c *Client) pool() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.workers
+}
+
+// getClient returns the client queries go through.
+func (c *Client) getClient() *http.Client {
+	c.Lock()
+	defer c.Unlock()
+	return c.client
+}
+
+// resetClient drops the connections kept open, in case they went bad.
+func (c *Client) resetClient() {
+	c.Lock()
+	defer c.Unlock()
+	c.client, _ = httpClient(c.workers, c.timeout, c.tls)
 }
 
-// HTTPClient generates an http client from the configuration
-// provided in the yaml input.
-func httpClient() (*http.Client, error) {
+// IsSeriesSelector reports whether a selector is a bare label matcher such as
+// {ft_target="true"}. Those are expanded into one range query per metric name
+// found through the series endpoint; anything else (a named selector or a full
+// PromQL expression such as rate(...)) is range queried as written.
+func IsSeriesSelector(selector string) bool {
+	trimmed := strings.TrimSpace(selector)
+	return strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}")
+}
+
+const (
+	// defaultTimeout is how long a query may take unless told otherwise.
+	defaultTimeout = 15 * time.Second
+	// defaultBackfill is the longest gap fetched again unless told otherwise, in seconds.
+	defaultBackfill = 3600
+)
+
+// httpClient generates an http client for the given number of concurrent
+// queries. A single worker gets no kept alive connections, several share a pool.
+// A nil tlsConfig uses the defaults.
+func httpClient(workers int, timeout time.Duration, tlsConfig *tls.Config) (*http.Client, error) {
+	transport := util.SingleConnNoKeepAliveTransporter()
+	if workers > 1 {
+		transport = util.PooledTransporter(workers)
+	}
+	transport.TLSClientConfig = tlsConfig
 	client := &http.Client{
-		Transport: util.SingleConnNoKeepAliveTransporter(),
-		Timeout:   15 * time.Second,
+		Transport: transport,
+		Timeout:   timeout,
 	}
 	return client, nil
 }
 
-// Fetch queries prometheus over http at a given endpoint and returns the body
+// Fetch queries prometheus over http at a given endpoint and returns the body.
+// The parameters of the endpoint are sent as a form in a POST, so long
+// selectors do not run into limits on the length of urls; a server too old to
+// take queries as POST gets them as GET from then on. Responses that are not
+// a success, by status code or by what prometheus says in the body, are errors.
 func (c *Client) Fetch(endpt string) ([]byte, error) {
 	pfx := queryExtract(endpt)
 	timer := prometheus.NewTimer(queryDurationsSummary.WithLabelValues(pfx))
-	req, _ := http.NewRequest("GET", endpt, nil)
-	resp, err := c.client.Do(req)
+	post := c.posting() && strings.Contains(endpt, "?")
+	body, code, err := c.send(endpt, post)
+	if err == nil && post && code == http.StatusMethodNotAllowed {
+		c.Lock()
+		c.post = false
+		c.Unlock()
+		log.Println("prometheus does not take queries as POST, sending them as GET")
+		body, code, err = c.send(endpt, false)
+	}
+	if err != nil {
+		return body, err
+	}
+	timer.ObserveDuration()
+	return body, checkResponse(code, body)
+}
+
+// posting reports whether queries go out as POST.
+func (c *Client) posting() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.post
+}
+
+// newRequest builds the request for an endpoint, moving its parameters into
+// a form body when post is set.
+func newRequest(endpt string, post bool) (*http.Request, error) {
+	if !post {
+		return http.NewRequest("GET", endpt, nil)
+	}
+	parsed, err := url.Parse(endpt)
+	if err != nil {
+		return nil, err
+	}
+	form := parsed.RawQuery
+	parsed.RawQuery = ""
+	req, err := http.NewRequest("POST", parsed.String(), strings.NewReader(form))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// send makes one request to an endpoint and returns what came back.
+func (c *Client) send(endpt string, post bool) ([]byte, int, error) {
+	req, err := newRequest(endpt, post)
 	if err != nil {
 		errorCounter.WithLabelValues("reaching_p8s").Inc()
-		return []byte{}, err
+		return []byte{}, 0, &queryError{"bad_request", false, err}
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return []byte{}, 0, err
 	}
 
-	body, _ := ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(resp.Body)
 	defer resp.Body.Close()
-	timer.ObserveDuration()
+	if err != nil {
+		return body, resp.StatusCode, &queryError{"read", true, err}
+	}
+	return body, resp.StatusCode, nil
+}
+
+// do sends a request on behalf of the client's tenant with its credentials,
+// once the tenant's rate limit allows.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if tenant := c.Tenant(); tenant != "" {
+		req.Header.Set(scopeOrgIDHeader, tenant)
+	}
+	if err := c.getCredentials().authorize(req); err != nil {
+		errorCounter.WithLabelValues("auth").Inc()
+		return nil, err
+	}
+	c.throttle()
+	resp, err := c.getClient().Do(req)
+	if err != nil {
+		if tlsFailure(err) {
+			errorCounter.WithLabelValues("tls").Inc()
+			return nil, &queryError{"tls", false, err}
+		}
+		errorCounter.WithLabelValues("reaching_p8s").Inc()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// apiURL builds the url of an API path with params encoded into its query string.
+func (c *Client) apiURL(path string, params url.Values) string {
+	c.Lock()
+	defer c.Unlock()
+	return c.P8s + path + "?" + params.Encode()
+}
 
-	return body, nil
+// rangeURL builds the url of a range query between start and end.
+func (c *Client) rangeURL(query string, start, end int64, step int) string {
+	return c.apiURL("/api/v1/query_range", url.Values{
+		"query": {query},
+		"start": {strconv.FormatInt(start, 10)},
+		"end":   {strconv.FormatInt(end, 10)},
+		"step":  {fmt.Sprintf("%ds", step)},
+	})
 }
 
 // DecodeRangeQ takes a response from the p8s query_range endpoint and decodes it.
@@ -135,49 +386,60 @@ func DecodeSeriesMatch(response []byte) SeriesMatch {
 	return target
 }
 
-// SeriesQuery generates a series querying string to be fetchdecoded.
-func (c *Client) SeriesQuery() string {
-	return fmt.Sprintf("%s/api/v1/series?match[]={ft_target=\"true\"}&start=%d&end=%d", c.P8s, c.start, time.Now().Unix())
+// SeriesQuery generates a series querying string to be fetchdecoded, covering
+// the time since the selector's series were last looked up.
+func (c *Client) SeriesQuery(selector string) string {
+	start, end := c.window(selector)
+	return c.apiURL("/api/v1/series", url.Values{
+		"match[]": {selector},
+		"start":   {strconv.Itoa(start)},
+		"end":     {strconv.Itoa(end)},
+	})
 }
 
-// knownSeries returns a list of known series names for p8s.
-func (c *Client) knownSeries() []string {
+// knownSeries returns a list of known series names for a selector.
+func (c *Client) knownSeries(selector string) []string {
 	c.Lock()
 	defer c.Unlock()
-	temp := make([]string, len(c.series))
+	temp := make([]string, len(c.series[selector]))
 	index := 0
-	for xx := range c.series {
+	for xx := range c.series[selector] {
 		temp[index] = xx
 		index++
 	}
 	return temp
 }
 
-//SeriesInsert puts series into a series store
-func (c *Client) SeriesInsert(input SeriesMatch) (number int) {
+//SeriesInsert puts series found for a selector into a series store
+func (c *Client) SeriesInsert(selector string, input SeriesMatch) (number int) {
 	c.Lock()
 	defer c.Unlock()
+	if _, ok := c.series[selector]; !ok {
+		c.series[selector] = make(map[string]bool)
+	}
 	for _, xx := range input.Data {
 		metricName := xx["__name__"]
-		c.series[metricName] = true
-	}
-	for _ = range c.series {
-		number++
+		c.series[selector][metricName] = true
 	}
+	number = len(c.series[selector])
 	internalDataSummary.WithLabelValues("series").Observe(float64(number))
 	return
 }
 
-// RangeQuery describes a prometheus range query needs timing and step information
-func (c *Client) RangeQuery(series string) string {
-	return fmt.Sprintf("%s/api/v1/query_range?query=%s{ft_target=\"true\"}&start=%v&end=%v&step=%vs",
-		c.P8s, series, c.start, c.end, c.Res)
+// RangeQuery describes a prometheus range query needs timing and step
+// information. It covers the time since the query last succeeded.
+func (c *Client) RangeQuery(query string) string {
+	start, end := c.window(query)
+	c.Lock()
+	res := c.Res
+	c.Unlock()
+	return c.rangeURL(query, int64(start), int64(end), res)
 }
 
-// RangeInsert turns RangeQ and puts them into internal storage.
-func (c *Client) RangeInsert(result RangeQ) {
-	internalDataSummary.WithLabelValues("range").Observe(float64(len(result.Data.Result)))
-	for _, xx := range result.Data.Result {
+// Series turns a range query result into series, dropping values that are not numbers.
+func (r RangeQ) Series() []util.Series {
+	out := make([]util.Series, 0, len(r.Data.Result))
+	for _, xx := range r.Data.Result {
 		mydata := make([]util.DataPoint, 0, len(xx.Values))
 		for _, yy := range xx.Values {
 			val, _ := yy[1].Float64()
@@ -186,25 +448,92 @@ func (c *Client) RangeInsert(result RangeQ) {
 				mydata = append(mydata, util.DataPoint{Val: val, Time: time})
 			}
 		}
-		if len(mydata) > 0 {
-			c.Store.ScoreData(mydata, xx.Metric, true)
-		}
+		out = append(out, util.Series{Labels: xx.Metric, Data: mydata})
 	}
+	return out
 }
 
-// RangeBatch does a range query for all the things that we know about.
-func (c *Client) RangeBatch() {
-	for _, xx := range c.knownSeries() {
-		query := c.RangeQuery(xx)
-		resp, err := c.Fetch(query)
-		if err != nil {
-			errorCounter.WithLabelValues("range query error").Inc()
-			return
+// RangeInsert turns RangeQ and puts them into internal storage, tagging every
+// series with the selector it came from and the tenant it belongs to. Only
+// points from the last step of the cycle are current; anything older is
+// backfill, which the models learn from without exporting what they make of it.
+func (c *Client) RangeInsert(selector string, result RangeQ) {
+	c.insert(selector, result.Series())
+}
+
+// insert scores series fetched for a selector, wherever they came from.
+func (c *Client) insert(selector string, series []util.Series) {
+	internalDataSummary.WithLabelValues("range").Observe(float64(len(series)))
+	c.Lock()
+	current, tenant := int64(c.end-c.Res), c.tenant
+	c.Unlock()
+	for _, xx := range series {
+		if len(xx.Data) > 0 {
+			labels := make(map[string]string, len(xx.Labels)+1)
+			for key, val := range xx.Labels {
+				labels[key] = val
+			}
+			labels[util.SelectorLabel] = selector
+			if tenant != "" {
+				labels[util.TenantLabel] = tenant
+			}
+			c.Store.ScoreData(xx.Data, labels, current)
 		}
+	}
+}
+
+// rangeQueries lists the queries to run for a selector. Remote read fetches
+// everything a bare selector matches at once, so it is not split up.
+func (c *Client) rangeQueries(selector string) []string {
+	if !IsSeriesSelector(selector) || c.remoteRead() != "" {
+		return []string{selector}
+	}
+	names := c.knownSeries(selector)
+	queries := make([]string, len(names))
+	for ii, xx := range names {
+		queries[ii] = xx + selector
+	}
+	return queries
+}
 
-		series, _ := DecodeRangeQ(resp)
-		c.RangeInsert(series)
+// RangeBatch does a range query for all the things that we know about, up to
+// pool of them at a time, and reports how many series came back. A query that
+// fails is retried and then given up on without holding up the rest.
+func (c *Client) RangeBatch() (found int) {
+	type job struct {
+		selector string
+		query    string
 	}
+	var (
+		jobs  = make(chan job)
+		wg    sync.WaitGroup
+		total int64
+	)
+	for ii := 0; ii < c.pool(); ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for jj := range jobs {
+				start, end := c.window(jj.query)
+				series, err := c.sourceFor(jj.query).Range(jj.query, start, end)
+				if err != nil {
+					errorCounter.WithLabelValues("range query error").Inc()
+					continue
+				}
+				c.insert(jj.selector, series)
+				c.advance(jj.query)
+				atomic.AddInt64(&total, int64(len(series)))
+			}
+		}()
+	}
+	for _, selector := range c.selectors() {
+		for _, query := range c.rangeQueries(selector) {
+			jobs <- job{selector, query}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return int(total)
 }
 
 // queryExtract pulls the query endpoint out of the query string. With short=false, it includes the name.
@@ -218,28 +547,86 @@ func queryExtract(query string) string {
 	return query
 }
 
-// SeriesBatch does an iteration of series work
-func (c *Client) SeriesBatch() int {
-	query := c.SeriesQuery()
-	resp, err := c.Fetch(query)
-	if err != nil {
-		errorCounter.WithLabelValues("series query error").Inc()
-		return 0
+// SeriesBatch does an iteration of series work for every bare selector. With
+// remote read there is nothing to do.
+func (c *Client) SeriesBatch() (out int) {
+	if c.remoteRead() != "" {
+		return
+	}
+	for _, selector := range c.selectors() {
+		if !IsSeriesSelector(selector) {
+			continue
+		}
+		resp, err := c.fetchRetry(c.SeriesQuery(selector), selector)
+		if err != nil {
+			errorCounter.WithLabelValues("series query error").Inc()
+			continue
+		}
+		series := DecodeSeriesMatch(resp)
+		out += c.SeriesInsert(selector, series)
+		c.advance(selector)
 	}
-	series := DecodeSeriesMatch(resp)
-	return c.SeriesInsert(series)
+	return
 }
 
-// PullData does all the prom stuff.
+// PullData does all the prom stuff and reports how many metric names and
+// series turned up; zero means prometheus gave us nothing.
 func (c *Client) PullData() (out int) {
 	out = c.SeriesBatch()
-	c.RangeBatch()
+	out += c.RangeBatch()
+	c.pruneMarks()
 	return
 }
 
 // Status is a human-readable output of what prom is trying to do.
 func (c *Client) Status() string {
-	return fmt.Sprintf("Looking for prometheus at %s", c.P8s)
+	status := fmt.Sprintf("Looking for prometheus at %s with selectors %s", c.P8s, strings.Join(c.selectors(), ", "))
+	if tenant := c.Tenant(); tenant != "" {
+		status += " for tenant " + tenant
+	}
+	return status
+}
+
+// Reload points a running client at a new configuration. Cached series names
+// of dropped selectors are forgotten; new selectors have never been fetched, so
+// the next cycle reaches back over the full lookback for them.
+func (c *Client) Reload(p8s string, selectors []string, res, lbk int) {
+	c.Lock()
+	defer c.Unlock()
+	if len(selectors) == 0 {
+		selectors = []string{DefaultSelector}
+	}
+	wanted := make(map[string]bool)
+	for _, xx := range selectors {
+		wanted[xx] = true
+	}
+	for xx := range c.series {
+		if !wanted[xx] {
+			delete(c.series, xx)
+		}
+	}
+	if p8s != c.P8s {
+		// a different server may well take queries as POST
+		c.post = true
+	}
+	c.P8s = p8s
+	c.Selectors = selectors
+	c.Res = res
+	c.Lookback = lbk
+}
+
+// selectors returns the current selectors.
+func (c *Client) selectors() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string{}, c.Selectors...)
+}
+
+// period is how long to wait between cycles.
+func (c *Client) period() time.Duration {
+	c.Lock()
+	defer c.Unlock()
+	return time.Duration(c.Res)*time.Second + time.Microsecond
 }
 
 // Stop a prometheus client
@@ -247,31 +634,73 @@ func (c *Client) Stop() {
 	c.Stopped = true
 }
 
-// Restart a stopped prom client
+// Restart a stopped prom client. Queries pick up from where they were, filling
+// in the time it was stopped as far as the backfill limit allows.
 func (c *Client) Restart() {
 	c.Stopped = false
-	c.client, _ = httpClient()
-	c.start = int(time.Now().Unix()) - c.Lookback*60
-	c.end = int(time.Now().Unix())
+	c.resetClient()
+}
+
+// Close stops a prometheus client for good, ending its cycle.
+func (c *Client) Close() {
+	c.Lock()
+	defer c.Unlock()
+	c.Stopped = true
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
 }
 
 func (c *Client) cycle() {
-	tck := time.NewTicker(time.Duration(c.Res)*time.Second + time.Microsecond)
-	for _ = range tck.C {
+	period := c.period()
+	tck := time.NewTicker(period)
+	defer tck.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-tck.C:
+		}
+		if current := c.period(); current != period {
+			period = current
+			tck.Reset(period)
+		}
 		if c.Stopped {
 			continue
 		}
-		numSeries := c.PullData()
-		if numSeries == 0 {
-			errorCounter.WithLabelValues("failed to get any series from p8s").Inc()
-			c.client, _ = httpClient()
-		} else {
-			c.start = c.end
+		if c.step(period) {
+			// skip the tick that came in meanwhile rather than starting the
+			// next cycle straight away; it picks up from where this one ended
+			select {
+			case <-tck.C:
+			default:
+			}
 		}
-		c.end = int(time.Now().Unix())
 	}
 }
 
+// step runs one cycle and reports whether it took longer than period.
+func (c *Client) step(period time.Duration) bool {
+	began := time.Now()
+	c.Lock()
+	c.end = int(began.Unix())
+	c.Unlock()
+	numSeries := c.PullData()
+	if numSeries == 0 {
+		errorCounter.WithLabelValues("failed to get any series from p8s").Inc()
+		c.resetClient()
+	}
+	took := time.Since(began)
+	cycleDuration.Observe(took.Seconds())
+	if took > period {
+		cycleOverruns.Inc()
+		return true
+	}
+	return false
+}
+
 // Start the runtime cycle.
 func (c *Client) Start() {
 	go c.cycle()
@@ -1,28 +1,39 @@
 package prom
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"strings"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/open-fresh/data-sidecar/util"
 )
 
+func init() {
+	// do not wait around between retries
+	retryBackoff = time.Millisecond
+}
+
 var (
 	n  = NullScorer{lastTime: make(map[string]int64)}
-	pc = NewClient("", 10, 60, &n)
+	pc = NewClient("", nil, 10, 60, &n)
 )
 
 type NullScorer struct {
+	mux      sync.Mutex
 	added    int
 	scored   int
 	lastTime map[string]int64
 }
 
 func (n *NullScorer) Add(labels map[string]string, value float64, ts int64) bool {
+	n.mux.Lock()
+	defer n.mux.Unlock()
 	labelString := util.MapSSToS(labels)
 	if n.lastTime[labelString] < ts {
 		n.added++
@@ -36,7 +47,12 @@ func (n *NullScorer) Score(map[string]string) {
 	n.scored++
 }
 
-func (n *NullScorer) ScoreData([]util.DataPoint, map[string]string, bool) {
+func (n *NullScorer) ScoreData(data []util.DataPoint, labels map[string]string, current int64) {
+	for _, xx := range data {
+		if n.Add(labels, xx.Val, xx.Time) && xx.Time >= current {
+			n.scored++
+		}
+	}
 }
 
 func (n *NullScorer) ScoreCollective() {
@@ -60,29 +76,93 @@ func TestDecode(t *testing.T) {
 }
 
 func TestQueries(t *testing.T) {
-	g := pc.SeriesQuery()
-	if !strings.Contains(g, "/api/v1/series?match[]={ft_target") {
-		t.Error(g)
+	g, err := url.Parse(pc.SeriesQuery(DefaultSelector))
+	if err != nil || g.Path != "/api/v1/series" || g.Query().Get("match[]") != DefaultSelector {
+		t.Error(g, err)
 	}
-	g = pc.RangeQuery("abcd")
-	if !strings.Contains(g, "/api/v1/query_range?query") {
-		t.Error(g)
+	g, err = url.Parse(pc.RangeQuery("abcd"))
+	if err != nil || g.Path != "/api/v1/query_range" || g.Query().Get("query") != "abcd" || g.Query().Get("step") != "10s" {
+		t.Error(g, err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	selectors := []string{
+		`{job="a\"b", path=~"/x/{1,2}&y=1"}`,
+		`sum by (le) (rate(höhe_total{région="Zürich #1"}[5m]))`,
+		`{__name__=~".+", emoji="🙂 + 1%"}`,
+	}
+	known := func(query string) bool {
+		for _, xx := range selectors {
+			if query == xx || query == "b"+xx {
+				return true
+			}
+		}
+		return false
+	}
+	var methods []string
+	allowPost := true
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/api/v1/series", func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if match := r.FormValue("match[]"); !known(match) || match[0] != '{' {
+			t.Error("series selector mangled:", r.FormValue("match[]"))
+		}
+		fmt.Fprint(w, `{"Status":"success","Data":[{"__name__":"b"}]}`)
+	})
+	serveMux.HandleFunc("/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && !allowPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		methods = append(methods, r.Method)
+		if query := r.FormValue("query"); !known(query) {
+			t.Error("range query mangled:", query)
+		}
+		fmt.Fprint(w, `{"Status":"success","Data":{"ResultType":"matrix","Result":[]}}`)
+	})
+	server := httptest.NewServer(serveMux)
+	defer server.Close()
+
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient(server.URL, selectors, 10, 60, &sc)
+	c.PullData()
+	if len(methods) != 5 {
+		t.Fatal(methods)
+	}
+	for _, method := range methods {
+		if method != "POST" {
+			t.Error("queries should be sent as POST", methods)
+		}
+	}
+
+	allowPost = false
+	methods = nil
+	if _, err := c.Fetch(c.RangeQuery(selectors[1])); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.Fetch(c.RangeQuery(selectors[2])); err != nil || len(methods) != 2 || methods[0] != "GET" || methods[1] != "GET" {
+		t.Error("older servers should get queries as GET from then on", methods, err)
+	}
+	c.Reload("http://elsewhere", selectors, 10, 60)
+	if !c.posting() {
+		t.Error("a new server should be tried with POST again")
 	}
 }
 
 func TestSeriesBits(t *testing.T) {
-	x := pc.knownSeries()
+	x := pc.knownSeries(DefaultSelector)
 	if len(x) > 0 {
 		t.Error(x)
 	}
 	seriesInp := []byte(`{"Status":"ok",
 		"Data":[{"__name__":"b"}]}`)
 	g := DecodeSeriesMatch(seriesInp)
-	num := pc.SeriesInsert(g)
+	num := pc.SeriesInsert(DefaultSelector, g)
 	if num != 1 {
 		t.Error(num)
 	}
-	x = pc.knownSeries()
+	x = pc.knownSeries(DefaultSelector)
 	if len(x) != 1 {
 		t.Error(x)
 	}
@@ -95,7 +175,37 @@ func TestSeriesBits(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	pc.RangeInsert(h)
+	pc.RangeInsert(DefaultSelector, h)
+}
+
+func TestSelectors(t *testing.T) {
+	if !IsSeriesSelector(DefaultSelector) || !IsSeriesSelector(` {job="a"} `) {
+		t.Error("bare matchers are series selectors")
+	}
+	if IsSeriesSelector(`up{job="a"}`) || IsSeriesSelector(`rate(x{job="a"}[5m])`) {
+		t.Error("named selectors and expressions are queried as written")
+	}
+
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient("", []string{`{job="a"}`, `rate(b[5m])`}, 10, 60, &sc)
+	c.SeriesInsert(`{job="a"}`, SeriesMatch{Data: []map[string]string{{"__name__": "b"}}})
+	if g := c.rangeQueries(`{job="a"}`); len(g) != 1 || g[0] != `b{job="a"}` {
+		t.Error(g)
+	}
+	if g := c.rangeQueries(`rate(b[5m])`); len(g) != 1 || g[0] != `rate(b[5m])` {
+		t.Error(g)
+	}
+
+	result := RangeQ{}
+	result.Data.Result = append(result.Data.Result, struct {
+		Metric map[string]string
+		Values [][]json.Number
+	}{map[string]string{"__name__": "b"}, [][]json.Number{{"1", "2"}}})
+	c.RangeInsert(`{job="a"}`, result)
+	c.RangeInsert(`rate(b[5m])`, result)
+	if sc.added != 2 {
+		t.Error("selectors should keep series apart", sc.lastTime)
+	}
 }
 
 func TestFetching(t *testing.T) {
@@ -160,3 +270,146 @@ func TestFetching(t *testing.T) {
 	pc.PullData()
 	server.Close()
 }
+
+func TestReload(t *testing.T) {
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient("", []string{`{job="a"}`}, 10, 60, &sc)
+	c.SeriesInsert(`{job="a"}`, SeriesMatch{Data: []map[string]string{{"__name__": "b"}}})
+	c.advance(`{job="a"}`)
+	c.Reload("http://elsewhere", []string{`{job="a"}`, `{job="b"}`}, 5, 10)
+	if c.P8s != "http://elsewhere" || len(c.selectors()) != 2 || c.period() < 5*time.Second {
+		t.Error(c.Status())
+	}
+	if start, end := c.window(`{job="b"}`); start != end-10*60 {
+		t.Error("new selectors should fetch the full lookback")
+	}
+	if start, end := c.window(`{job="a"}`); start != end {
+		t.Error("known selectors should pick up where they were")
+	}
+	c.Reload("http://elsewhere", []string{`{job="b"}`}, 5, 10)
+	if len(c.knownSeries(`{job="a"}`)) != 0 {
+		t.Error("dropped selectors should forget their series")
+	}
+	c.Reload("http://elsewhere", nil, 5, 10)
+	if g := c.selectors(); len(g) != 1 || g[0] != DefaultSelector {
+		t.Error(g)
+	}
+}
+
+func TestRangePool(t *testing.T) {
+	var inFlight, most, started, served int32
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&started, 1)
+		now := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&most)
+			if now <= seen || atomic.CompareAndSwapInt32(&most, seen, now) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&served, 1)
+		fmt.Fprintf(w, `{"Status":"success","Data":{"ResultType":"matrix","Result":[
+			{"Metric":{"q":%q},"Values":[[1,"1"]]}]}}`, r.FormValue("query"))
+	})
+	server := httptest.NewServer(serveMux)
+	defer server.Close()
+
+	selectors := make([]string, 12)
+	for ii := range selectors {
+		selectors[ii] = fmt.Sprintf("sum(metric_%d)", ii)
+	}
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient(server.URL, selectors, 10, 60, &sc)
+	c.SetPool(3, time.Second)
+	if found := c.RangeBatch(); found != 12 || served != 12 {
+		t.Error(found, served)
+	}
+	if most != 3 {
+		t.Error("expected three queries at a time, got", most)
+	}
+
+	c.SetPool(3, 10*time.Millisecond)
+	atomic.StoreInt32(&started, 0)
+	if found := c.RangeBatch(); found != 0 || atomic.LoadInt32(&started) != int32(12*(queryRetries+1)) {
+		t.Error("every query should time out and be retried", found, started)
+	}
+
+	c.SetPool(3, time.Second)
+	if !c.step(time.Millisecond) || c.step(time.Minute) {
+		t.Error("a cycle longer than its period is an overrun")
+	}
+}
+
+func TestClose(t *testing.T) {
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient("http://localhost:0", nil, 1, 60, &sc)
+	ended := make(chan bool)
+	go func() {
+		c.cycle()
+		ended <- true
+	}()
+	c.Close()
+	c.Close()
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		t.Error("closing a client should end its cycle")
+	}
+	if !c.Stopped {
+		t.Error("a closed client is stopped")
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	var down int32
+	starts := make(chan string, 10)
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		starts <- r.FormValue("start")
+		fmt.Fprint(w, `{"Status":"success","Data":{"ResultType":"matrix","Result":[]}}`)
+	})
+	server := httptest.NewServer(serveMux)
+	defer server.Close()
+
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient(server.URL, []string{"sum(x)"}, 10, 60, &sc)
+	c.SetBackfill(600)
+	now := c.end
+	fetch := func(end int) string {
+		c.end = end
+		c.RangeBatch()
+		select {
+		case start := <-starts:
+			return start
+		default:
+			return ""
+		}
+	}
+	if g := fetch(now); g != fmt.Sprint(now-3600) {
+		t.Error("the first fetch should reach over the lookback", g)
+	}
+	atomic.StoreInt32(&down, 1)
+	if g := fetch(now + 100); g != "" {
+		t.Error(g)
+	}
+	atomic.StoreInt32(&down, 0)
+	if g := fetch(now + 200); g != fmt.Sprint(now) {
+		t.Error("a failed fetch should be backfilled", g)
+	}
+	if g := fetch(now + 2000); g != fmt.Sprint(now+1400) {
+		t.Error("a gap longer than the backfill should be cut short", g)
+	}
+
+	c.Reload(server.URL, []string{"sum(y)"}, 10, 60)
+	c.pruneMarks()
+	if len(c.marks) != 0 {
+		t.Error("marks of dropped queries should be forgotten", c.marks)
+	}
+}
@@ -0,0 +1,226 @@
+package prom
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/open-fresh/data-sidecar/prompb"
+	"github.com/open-fresh/data-sidecar/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// maxWriteSize is the largest remote write payload taken, once decompressed.
+	maxWriteSize = 32 << 20
+	// maxPushLag is how far behind now, in seconds, the newest sample of a
+	// pushed series may be for it to still count as live rather than replayed.
+	maxPushLag = 300
+)
+
+var (
+	receivedSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_received_samples_total",
+		Help: "Samples pushed by remote write, by what became of them"},
+		[]string{"result"})
+	receivedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_received_requests_total",
+		Help: "Remote write requests received, by response code"},
+		[]string{"code"})
+)
+
+func init() {
+	prometheus.MustRegister(receivedSamples)
+	prometheus.MustRegister(receivedRequests)
+}
+
+// Receiver takes the samples prometheus pushes by remote write and scores the
+// series its selectors match as they arrive, instead of waiting for a client
+// to fetch them.
+type Receiver struct {
+	*sync.Mutex
+	selectors map[string]*prompb.Selector
+	scorers   map[string]util.ScoringEngine
+	step      int64
+}
+
+// NewReceiver returns a receiver that takes nothing until it is given
+// selectors and a scorer.
+func NewReceiver() *Receiver {
+	var mux sync.Mutex
+	return &Receiver{&mux, make(map[string]*prompb.Selector), make(map[string]util.ScoringEngine), 0}
+}
+
+// SetStep sets the resolution, in seconds. Only samples from the last step
+// before the newest sample of their series are current.
+func (r *Receiver) SetStep(seconds int) {
+	r.Lock()
+	defer r.Unlock()
+	r.step = int64(seconds)
+}
+
+// SetSelectors replaces the plain selectors pushed series are matched
+// against. Nothing changes if any of them is not a plain selector.
+func (r *Receiver) SetSelectors(selectors []string) error {
+	compiled := make(map[string]*prompb.Selector, len(selectors))
+	for _, xx := range selectors {
+		sel, ok := prompb.CompileSelector(xx)
+		if !ok {
+			return fmt.Errorf("cannot receive %s, it is not a plain selector", xx)
+		}
+		compiled[xx] = sel
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.selectors = compiled
+	return nil
+}
+
+// SetScorer scores the series pushed for a tenant with scorer, or stops
+// taking them when scorer is nil. Pushes without an X-Scope-OrgID belong to
+// the unnamed tenant.
+func (r *Receiver) SetScorer(tenant string, scorer util.ScoringEngine) {
+	r.Lock()
+	defer r.Unlock()
+	if scorer == nil {
+		delete(r.scorers, tenant)
+		return
+	}
+	r.scorers[tenant] = scorer
+}
+
+// scorerFor looks up who scores the pushes of a tenant, and which tenant they
+// count for. When only the unnamed tenant is known it takes everything,
+// whatever X-Scope-OrgID says.
+func (r *Receiver) scorerFor(tenant string) (util.ScoringEngine, string, bool) {
+	r.Lock()
+	defer r.Unlock()
+	if scorer, ok := r.scorers[tenant]; ok {
+		return scorer, tenant, true
+	}
+	if scorer, ok := r.scorers[""]; ok && len(r.scorers) == 1 {
+		return scorer, "", true
+	}
+	return nil, tenant, false
+}
+
+// matching lists, in order, the selectors a series' labels match.
+func (r *Receiver) matching(labels map[string]string) []string {
+	r.Lock()
+	defer r.Unlock()
+	out := make([]string, 0)
+	for name, sel := range r.selectors {
+		if sel.Matches(labels) {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// HandleFunc takes a snappy compressed WriteRequest on POST /api/v1/write.
+// Series are scored once for every selector they match, labelled with it the
+// same way fetched series are; samples the store already has are skipped.
+func (r *Receiver) HandleFunc(w http.ResponseWriter, req *http.Request) {
+	code, err := r.receive(req)
+	receivedRequests.WithLabelValues(fmt.Sprint(code)).Inc()
+	w.WriteHeader(code)
+	if err != nil {
+		fmt.Fprint(w, err)
+	}
+}
+
+// receive handles one push and returns the status to answer with.
+func (r *Receiver) receive(req *http.Request) (int, error) {
+	if req.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, fmt.Errorf("Only POST requests allowed")
+	}
+	scorer, tenant, ok := r.scorerFor(req.Header.Get(scopeOrgIDHeader))
+	if !ok {
+		return http.StatusNotFound, fmt.Errorf("unknown tenant %q", tenant)
+	}
+	compressed, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if size, err := snappy.DecodedLen(compressed); err != nil || size > maxWriteSize {
+		return http.StatusBadRequest, fmt.Errorf("write request is not snappy compressed or larger than %d bytes", maxWriteSize)
+	}
+	raw, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	var write prompb.WriteRequest
+	if err = proto.Unmarshal(raw, &write); err != nil {
+		return http.StatusBadRequest, err
+	}
+	r.Lock()
+	step := r.step
+	r.Unlock()
+	for _, series := range write.Timeseries {
+		r.score(scorer, tenant, series, step)
+	}
+	return http.StatusNoContent, nil
+}
+
+// current is the time the samples of a pushed series have to be from to be
+// exported: one step before its newest sample, so samples remote write took a
+// while to deliver still count. A series whose newest sample is more than
+// maxPushLag behind now is being replayed, and none of it is current.
+func current(data []util.DataPoint, step int64) int64 {
+	newest := int64(math.MinInt64)
+	for _, xx := range data {
+		if xx.Time > newest {
+			newest = xx.Time
+		}
+	}
+	if newest < time.Now().Unix()-maxPushLag {
+		return math.MaxInt64
+	}
+	return newest - step
+}
+
+// score hands the samples of one pushed series to the scorer as a range, so
+// samples that are not current only update the models, as backfilled points
+// do. Staleness markers and other values that are not numbers are dropped.
+func (r *Receiver) score(scorer util.ScoringEngine, tenant string, series *prompb.TimeSeries, step int64) {
+	labels := series.LabelMap()
+	selectors := r.matching(labels)
+	if len(selectors) == 0 {
+		receivedSamples.WithLabelValues("unmatched").Add(float64(len(series.Samples)))
+		return
+	}
+	data := make([]util.DataPoint, 0, len(series.Samples))
+	for _, sample := range series.Samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			receivedSamples.WithLabelValues("invalid").Add(float64(len(selectors)))
+			continue
+		}
+		data = append(data, util.DataPoint{Val: sample.Value, Time: sample.Timestamp / 1000})
+	}
+	cutoff := current(data, step)
+	for _, xx := range data {
+		if xx.Time < cutoff {
+			receivedSamples.WithLabelValues("backfill").Add(float64(len(selectors)))
+		} else {
+			receivedSamples.WithLabelValues("current").Add(float64(len(selectors)))
+		}
+	}
+	for _, selector := range selectors {
+		kvs := make(map[string]string, len(labels)+2)
+		for key, val := range labels {
+			kvs[key] = val
+		}
+		kvs[util.SelectorLabel] = selector
+		if tenant != "" {
+			kvs[util.TenantLabel] = tenant
+		}
+		scorer.ScoreData(data, kvs, cutoff)
+	}
+}
@@ -0,0 +1,104 @@
+package prom
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/open-fresh/data-sidecar/prompb"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+func push(r *Receiver, tenant string, series ...*prompb.TimeSeries) int {
+	raw, _ := proto.Marshal(&prompb.WriteRequest{Timeseries: series})
+	req := httptest.NewRequest("POST", "/api/v1/write", bytes.NewReader(snappy.Encode(nil, raw)))
+	if tenant != "" {
+		req.Header.Set(scopeOrgIDHeader, tenant)
+	}
+	rw := httptest.NewRecorder()
+	r.HandleFunc(rw, req)
+	return rw.Code
+}
+
+func pushed(job string, samples ...*prompb.Sample) *prompb.TimeSeries {
+	return &prompb.TimeSeries{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: job}},
+		Samples: samples,
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	r := NewReceiver()
+	if err := r.SetSelectors([]string{`sum(up)`}); err == nil {
+		t.Error("expressions cannot be matched against pushed series")
+	}
+	if err := r.SetSelectors([]string{`up{job=~"a|b"}`, `{job="a"}`}); err != nil {
+		t.Fatal(err)
+	}
+	if code := push(r, "", pushed("a", &prompb.Sample{Value: 1, Timestamp: 1000})); code != http.StatusNotFound {
+		t.Error("nothing should be taken without a scorer", code)
+	}
+
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	r.SetScorer("", &sc)
+	r.SetStep(10)
+	now := time.Now().Unix() * 1000
+	code := push(r, "team-x",
+		pushed("a", &prompb.Sample{Value: 1, Timestamp: 1000}, &prompb.Sample{Value: math.NaN(), Timestamp: 2000},
+			&prompb.Sample{Value: 2, Timestamp: 2500}, &prompb.Sample{Value: 3, Timestamp: 3000}),
+		pushed("b", &prompb.Sample{Value: 1, Timestamp: 1000}),
+		pushed("c", &prompb.Sample{Value: 1, Timestamp: 1000}))
+	if code != http.StatusNoContent {
+		t.Fatal(code)
+	}
+	// a matches both selectors, b one and c none; the stale marker is dropped
+	if sc.added != 2*3+1 || sc.scored != 0 {
+		t.Error("replayed samples should only update the models", sc.added, sc.scored)
+	}
+	push(r, "team-x", pushed("b", &prompb.Sample{Value: 1, Timestamp: now - 60000}, &prompb.Sample{Value: 2, Timestamp: now}))
+	if sc.added != 2*3+3 || sc.scored != 1 {
+		t.Error("only samples from the last step should be exported", sc.added, sc.scored)
+	}
+	labels := map[string]string{"__name__": "up", "job": "a", util.SelectorLabel: `{job="a"}`}
+	if sc.lastTime[util.MapSSToS(labels)] != 3 {
+		t.Error("pushed series should be labelled like fetched ones, with times in seconds", sc.lastTime)
+	}
+	// remote write took longer than a step to deliver these
+	push(r, "team-x", pushed("a", &prompb.Sample{Value: 1, Timestamp: now - 45000}, &prompb.Sample{Value: 2, Timestamp: now - 30000}))
+	if sc.added != 2*3+3+2*2 || sc.scored != 1+2 {
+		t.Error("the newest step of a series should be exported however late it comes", sc.added, sc.scored)
+	}
+
+	sc.Reset()
+	push(r, "", pushed("a", &prompb.Sample{Value: 1, Timestamp: 3000}))
+	if sc.added != 0 {
+		t.Error("samples already stored should be skipped", sc.added)
+	}
+
+	other := NullScorer{lastTime: make(map[string]int64)}
+	r.SetScorer("team-a", &other)
+	if code := push(r, "team-x", pushed("b", &prompb.Sample{Value: 1, Timestamp: 9000})); code != http.StatusNotFound {
+		t.Error("unknown tenants should be refused once there are tenants", code)
+	}
+	push(r, "team-a", pushed("b", &prompb.Sample{Value: 1, Timestamp: 9000}))
+	labels = map[string]string{"__name__": "up", "job": "b", util.SelectorLabel: `up{job=~"a|b"}`, util.TenantLabel: "team-a"}
+	if other.lastTime[util.MapSSToS(labels)] != 9 {
+		t.Error(other.lastTime)
+	}
+
+	rw := httptest.NewRecorder()
+	r.HandleFunc(rw, httptest.NewRequest("POST", "/api/v1/write", bytes.NewReader([]byte("not snappy"))))
+	if rw.Code != http.StatusBadRequest {
+		t.Error(rw.Code)
+	}
+	rw = httptest.NewRecorder()
+	r.HandleFunc(rw, httptest.NewRequest("GET", "/api/v1/write", nil))
+	if rw.Code != http.StatusMethodNotAllowed {
+		t.Error(rw.Code)
+	}
+}
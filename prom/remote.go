@@ -0,0 +1,202 @@
+package prom
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/open-fresh/data-sidecar/prompb"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// lookbackDelta is how far back a step looks for the latest sample, as in
+// prometheus' own range queries.
+const lookbackDelta = 5 * 60 * 1000
+
+// SetRemoteRead makes the client fetch plain selectors through the remote
+// read endpoint at the given url instead of the query_range API. Expressions
+// still go through the API. An empty url turns remote read off.
+func (c *Client) SetRemoteRead(endpoint string) {
+	c.Lock()
+	defer c.Unlock()
+	c.remote = endpoint
+}
+
+// remoteRead returns the remote read url, empty when it is off.
+func (c *Client) remoteRead() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.remote
+}
+
+// remoteSource fetches through prometheus' remote read protocol, which hands
+// over stored samples without rendering them as json.
+type remoteSource struct {
+	c        *Client
+	endpoint string
+}
+
+// Range reads the samples of the series a selector matches and lines them up
+// on the steps a range query would have.
+func (r remoteSource) Range(query string, start, end int) ([]util.Series, error) {
+	matchers, ok := prompb.ParseSelector(query)
+	if !ok {
+		return nil, &queryError{"bad_selector", false, fmt.Errorf("cannot remote read %s", query)}
+	}
+	r.c.Lock()
+	step := int64(r.c.Res) * 1000
+	r.c.Unlock()
+	from, until := int64(start)*1000, int64(end)*1000
+	req := &prompb.ReadRequest{
+		Queries: []*prompb.Query{{
+			StartTimestampMs: from - lookbackDelta,
+			EndTimestampMs:   until,
+			Matchers:         matchers,
+			Hints:            &prompb.ReadHints{StepMs: step, StartMs: from, EndMs: until},
+		}},
+		AcceptedResponseTypes: []prompb.ResponseType{prompb.StreamedXORChunks, prompb.Samples},
+	}
+	raw, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	body := snappy.Encode(nil, raw)
+
+	var out []util.Series
+	err = retry(queryMetric(query), func() error {
+		got, err := r.read(body)
+		if err != nil {
+			return err
+		}
+		out = make([]util.Series, 0, len(got))
+		for _, xx := range got {
+			out = append(out, util.Series{Labels: xx.Labels, Data: resample(xx.Data, from, until, step)})
+		}
+		return nil
+	})
+	return out, err
+}
+
+// read sends one remote read request and decodes whichever kind of response
+// comes back. Points come back with times in milliseconds.
+func (r remoteSource) read(body []byte) ([]util.Series, error) {
+	req, err := http.NewRequest("POST", r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, &queryError{"bad_request", false, err}
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", prompb.ContentTypeSamples)
+	req.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+	resp, err := r.c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, checkResponse(resp.StatusCode, msg)
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-streamed-protobuf") {
+		return readChunks(bufio.NewReader(resp.Body))
+	}
+	return readSamples(resp.Body)
+}
+
+// readSamples decodes a snappy compressed ReadResponse.
+func readSamples(in io.Reader) ([]util.Series, error) {
+	compressed, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, &queryError{"read", true, err}
+	}
+	raw, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, &queryError{"decode", false, err}
+	}
+	var resp prompb.ReadResponse
+	if err = proto.Unmarshal(raw, &resp); err != nil {
+		return nil, &queryError{"decode", false, err}
+	}
+	out := make([]util.Series, 0)
+	for _, result := range resp.Results {
+		for _, xx := range result.Timeseries {
+			data := make([]util.DataPoint, len(xx.Samples))
+			for ii, yy := range xx.Samples {
+				data[ii] = util.DataPoint{Val: yy.Value, Time: yy.Timestamp}
+			}
+			out = append(out, util.Series{Labels: xx.LabelMap(), Data: data})
+		}
+	}
+	return out, nil
+}
+
+// readChunks decodes a stream of ChunkedReadResponse frames as they arrive. A
+// series split over several frames is put back together.
+func readChunks(in *bufio.Reader) ([]util.Series, error) {
+	out := make([]util.Series, 0)
+	index := make(map[string]int)
+	for {
+		frame, err := prompb.ReadFrame(in)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, &queryError{"read", true, err}
+		}
+		var resp prompb.ChunkedReadResponse
+		if err = proto.Unmarshal(frame, &resp); err != nil {
+			return nil, &queryError{"decode", false, err}
+		}
+		for _, xx := range resp.ChunkedSeries {
+			labels := xx.LabelMap()
+			key := util.MapSSToS(labels)
+			if _, ok := index[key]; !ok {
+				index[key] = len(out)
+				out = append(out, util.Series{Labels: labels})
+			}
+			series := &out[index[key]]
+			for _, chunk := range xx.Chunks {
+				if chunk.Type != prompb.EncodingXOR {
+					return nil, &queryError{"decode", false, fmt.Errorf("unknown chunk encoding %d", chunk.Type)}
+				}
+				samples, err := prompb.DecodeXOR(chunk.Data)
+				if err != nil {
+					return nil, &queryError{"decode", false, err}
+				}
+				for _, yy := range samples {
+					series.Data = append(series.Data, util.DataPoint{Val: yy.Value, Time: yy.Timestamp})
+				}
+			}
+		}
+	}
+}
+
+// resample lines raw samples, with times in milliseconds, up on the steps
+// between from and until the way a range query does: each step takes the
+// latest sample no more than lookbackDelta before it. Steps with nothing
+// recent, or whose latest sample is not a number such as a staleness marker,
+// are left out. Times come back in seconds.
+func resample(samples []util.DataPoint, from, until, step int64) []util.DataPoint {
+	out := make([]util.DataPoint, 0)
+	next := 0
+	for at := from; at <= until; at += step {
+		for next < len(samples) && samples[next].Time <= at {
+			next++
+		}
+		if next == 0 {
+			continue
+		}
+		latest := samples[next-1]
+		if at-latest.Time >= lookbackDelta || math.IsNaN(latest.Val) || math.IsInf(latest.Val, 0) {
+			continue
+		}
+		out = append(out, util.DataPoint{Val: latest.Val, Time: at / 1000})
+	}
+	return out
+}
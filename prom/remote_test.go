@@ -0,0 +1,175 @@
+package prom
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/open-fresh/data-sidecar/prompb"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// fakeRemote is an in-process remote read endpoint serving a few series,
+// answering with streamed chunks when streamed is set and it is asked for them.
+type fakeRemote struct {
+	series   []*prompb.TimeSeries
+	streamed bool
+	reads    int32
+	queries  int32
+}
+
+func (f *fakeRemote) matches(series *prompb.TimeSeries, matchers []*prompb.LabelMatcher) bool {
+	labels := series.LabelMap()
+	for _, mm := range matchers {
+		re := regexp.MustCompile("^(?:" + mm.Value + ")$")
+		switch mm.Type {
+		case prompb.MatchEqual:
+			if labels[mm.Name] != mm.Value {
+				return false
+			}
+		case prompb.MatchNotEqual:
+			if labels[mm.Name] == mm.Value {
+				return false
+			}
+		case prompb.MatchRegexp:
+			if !re.MatchString(labels[mm.Name]) {
+				return false
+			}
+		case prompb.MatchNotRegexp:
+			if re.MatchString(labels[mm.Name]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (f *fakeRemote) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v1/query_range" {
+		atomic.AddInt32(&f.queries, 1)
+		fmt.Fprint(w, `{"Status":"success","Data":{"ResultType":"matrix","Result":[]}}`)
+		return
+	}
+	atomic.AddInt32(&f.reads, 1)
+	compressed, _ := ioutil.ReadAll(r.Body)
+	raw, err := snappy.Decode(nil, compressed)
+	var req prompb.ReadRequest
+	if err == nil {
+		err = proto.Unmarshal(raw, &req)
+	}
+	if err != nil || r.Header.Get("Content-Encoding") != "snappy" || len(req.Queries) != 1 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	query := req.Queries[0]
+	var found []*prompb.TimeSeries
+	for _, xx := range f.series {
+		if !f.matches(xx, query.Matchers) {
+			continue
+		}
+		kept := &prompb.TimeSeries{Labels: xx.Labels}
+		for _, yy := range xx.Samples {
+			if yy.Timestamp >= query.StartTimestampMs && yy.Timestamp <= query.EndTimestampMs {
+				kept.Samples = append(kept.Samples, yy)
+			}
+		}
+		found = append(found, kept)
+	}
+
+	if !f.streamed || req.AcceptedResponseTypes[0] != prompb.StreamedXORChunks {
+		out, _ := proto.Marshal(&prompb.ReadResponse{Results: []*prompb.QueryResult{{Timeseries: found}}})
+		w.Header().Set("Content-Type", prompb.ContentTypeSamples)
+		w.Header().Set("Content-Encoding", "snappy")
+		w.Write(snappy.Encode(nil, out))
+		return
+	}
+	// every series comes in two frames of two chunks each
+	w.Header().Set("Content-Type", prompb.ContentTypeStreamed)
+	for half := 0; half < 2; half++ {
+		frame := &prompb.ChunkedReadResponse{}
+		for _, xx := range found {
+			part := &prompb.ChunkedSeries{Labels: xx.Labels}
+			samples := xx.Samples[half*len(xx.Samples)/2 : (half+1)*len(xx.Samples)/2]
+			for quarter := 0; quarter < 2; quarter++ {
+				chunk := make([]prompb.Sample, 0)
+				for _, yy := range samples[quarter*len(samples)/2 : (quarter+1)*len(samples)/2] {
+					chunk = append(chunk, *yy)
+				}
+				part.Chunks = append(part.Chunks, &prompb.Chunk{Type: prompb.EncodingXOR, Data: prompb.EncodeXOR(chunk)})
+			}
+			frame.ChunkedSeries = append(frame.ChunkedSeries, part)
+		}
+		out, _ := proto.Marshal(frame)
+		prompb.WriteFrame(w, out)
+	}
+}
+
+func TestResample(t *testing.T) {
+	samples := []util.DataPoint{{Val: 1, Time: 1000}, {Val: 2, Time: 16000}, {Val: 3, Time: 400000}}
+	got := resample(samples, 0, 400000, 10000)
+	if len(got) == 0 || got[0].Time != 10 || got[0].Val != 1 || got[1].Val != 2 {
+		t.Error(got)
+	}
+	for _, xx := range got {
+		if xx.Time > 316 && xx.Time < 400 {
+			t.Error("steps more than five minutes past a sample should be empty", xx)
+		}
+	}
+	if last := got[len(got)-1]; last.Time != 400 || last.Val != 3 {
+		t.Error(last)
+	}
+}
+
+func TestRemoteRead(t *testing.T) {
+	const end = 1600000000
+	fake := &fakeRemote{}
+	for _, job := range []string{"a", "a", "b"} {
+		series := &prompb.TimeSeries{Labels: []*prompb.Label{
+			{Name: "__name__", Value: "up"}, {Name: "job", Value: job}, {Name: "instance", Value: fmt.Sprint(len(fake.series))}}}
+		for ts := int64(end - 3600); ts <= end; ts += 15 {
+			series.Samples = append(series.Samples, &prompb.Sample{Value: float64(ts % 97), Timestamp: ts * 1000})
+		}
+		fake.series = append(fake.series, series)
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	for _, streamed := range []bool{false, true} {
+		fake.streamed = streamed
+		atomic.StoreInt32(&fake.reads, 0)
+		atomic.StoreInt32(&fake.queries, 0)
+		sc := NullScorer{lastTime: make(map[string]int64)}
+		c := NewClient(server.URL, []string{`{job="a"}`, `sum(rate(up[5m]))`}, 10, 60, &sc)
+		c.SetRemoteRead(server.URL + "/api/v1/read")
+		c.end = end
+		if found := c.PullData(); found != 2 {
+			t.Error(streamed, "expected the two series of job a, got", found)
+		}
+		if fake.reads != 1 || fake.queries != 1 {
+			t.Error(streamed, "selectors should be read remotely and expressions queried", fake.reads, fake.queries)
+		}
+		if sc.added != 2*361 {
+			t.Error(streamed, "expected a point every step of the hour, got", sc.added)
+		}
+		labels := map[string]string{"__name__": "up", "job": "a", "instance": "0", util.SelectorLabel: `{job="a"}`}
+		if sc.lastTime[util.MapSSToS(labels)] != end {
+			t.Error(streamed, sc.lastTime)
+		}
+	}
+
+	c := NewClient(server.URL, []string{`{job="a"}`}, 10, 60, nil)
+	// the query API answers with json, not a remote read response
+	c.SetRemoteRead(server.URL + "/api/v1/query_range")
+	if _, err := c.sourceFor(`{job="a"}`).Range(`{job="a"}`, end-60, end); err == nil {
+		t.Error("a broken remote read answer should fail")
+	}
+	if _, ok := c.sourceFor(`rate(up[5m])`).(apiSource); !ok {
+		t.Error("expressions should go through the API")
+	}
+}
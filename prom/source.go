@@ -0,0 +1,45 @@
+package prom
+
+import (
+	"github.com/open-fresh/data-sidecar/prompb"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// Source fetches the points a query gives between two times, in seconds, at
+// the client's resolution. Failures that may go away are retried.
+type Source interface {
+	Range(query string, start, end int) ([]util.Series, error)
+}
+
+// apiSource fetches through the query_range API, which takes any expression.
+type apiSource struct {
+	c *Client
+}
+
+// Range runs query as a range query.
+func (a apiSource) Range(query string, start, end int) ([]util.Series, error) {
+	a.c.Lock()
+	res := a.c.Res
+	a.c.Unlock()
+	resp, err := a.c.fetchRetry(a.c.rangeURL(query, int64(start), int64(end), res), queryMetric(query))
+	if err != nil {
+		return nil, err
+	}
+	result, err := DecodeRangeQ(resp)
+	if err != nil {
+		queryFailures.WithLabelValues("decode", queryMetric(query)).Inc()
+		return nil, err
+	}
+	return result.Series(), nil
+}
+
+// sourceFor picks where to fetch a query from: remote read when it is set up
+// and the query is a plain selector it can answer, the query_range API otherwise.
+func (c *Client) sourceFor(query string) Source {
+	if endpoint := c.remoteRead(); endpoint != "" {
+		if _, ok := prompb.ParseSelector(query); ok {
+			return remoteSource{c, endpoint}
+		}
+	}
+	return apiSource{c}
+}
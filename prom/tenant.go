@@ -0,0 +1,82 @@
+package prom
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_query_throttled_seconds_total",
+		Help: "Time queries spent waiting for the query rate limit of their tenant"},
+		[]string{"tenant"})
+)
+
+func init() {
+	prometheus.MustRegister(throttled)
+}
+
+// limiter spaces queries out so no more than a given number go out a second.
+type limiter struct {
+	*sync.Mutex
+	every time.Duration
+	next  time.Time
+}
+
+// newLimiter allows rate queries a second; a rate of zero does not limit.
+func newLimiter(rate float64) *limiter {
+	var mux sync.Mutex
+	every := time.Duration(0)
+	if rate > 0 {
+		every = time.Duration(float64(time.Second) / rate)
+	}
+	return &limiter{&mux, every, time.Time{}}
+}
+
+// wait blocks until the next query may go out and returns how long that took.
+func (l *limiter) wait() time.Duration {
+	l.Lock()
+	if l.every == 0 {
+		l.Unlock()
+		return 0
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	until := l.next.Sub(now)
+	l.next = l.next.Add(l.every)
+	l.Unlock()
+	time.Sleep(until)
+	return until
+}
+
+// SetTenant makes the client fetch for a tenant of a multi-tenant prometheus
+// such as Cortex or Mimir. Every request carries the tenant as X-Scope-OrgID,
+// every series is labelled with it, and at most rate queries go out a second;
+// zero does not limit them. An empty tenant sends no header and adds no label.
+func (c *Client) SetTenant(tenant string, rate float64) {
+	c.Lock()
+	defer c.Unlock()
+	c.tenant = tenant
+	c.limit = newLimiter(rate)
+}
+
+// Tenant returns the tenant the client fetches for.
+func (c *Client) Tenant() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.tenant
+}
+
+// throttle waits for the tenant's query rate limit.
+func (c *Client) throttle() {
+	c.Lock()
+	limit, tenant := c.limit, c.tenant
+	c.Unlock()
+	if waited := limit.wait(); waited > 0 {
+		throttled.WithLabelValues(tenant).Add(waited.Seconds())
+	}
+}
@@ -0,0 +1,60 @@
+package prom
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+func TestTenant(t *testing.T) {
+	orgs := make(chan string, 10)
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		orgs <- r.Header.Get(scopeOrgIDHeader)
+		fmt.Fprint(w, `{"Status":"success","Data":{"ResultType":"matrix","Result":[
+			{"Metric":{"__name__":"a"},"Values":[[1,"1"]]}]}}`)
+	})
+	server := httptest.NewServer(serveMux)
+	defer server.Close()
+
+	sc := NullScorer{lastTime: make(map[string]int64)}
+	c := NewClient(server.URL, []string{"sum(a)"}, 10, 60, &sc)
+	c.RangeBatch()
+	if g := <-orgs; g != "" {
+		t.Error("no tenant should send no header", g)
+	}
+	if _, ok := sc.lastTime[util.MapSSToS(map[string]string{"__name__": "a", util.SelectorLabel: "sum(a)"})]; !ok {
+		t.Error("no tenant should add no label", sc.lastTime)
+	}
+
+	c.SetTenant("team-a", 0)
+	c.RangeBatch()
+	if g := <-orgs; g != "team-a" {
+		t.Error(g)
+	}
+	labels := map[string]string{"__name__": "a", util.SelectorLabel: "sum(a)", util.TenantLabel: "team-a"}
+	if _, ok := sc.lastTime[util.MapSSToS(labels)]; !ok {
+		t.Error("series should carry their tenant", sc.lastTime)
+	}
+	if g := historyQuery(labels, "team-a"); g != "a{}" {
+		t.Error("the tenant goes in the header, not the query", g)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if newLimiter(0).wait() != 0 {
+		t.Error("a zero rate should not limit")
+	}
+	limit := newLimiter(100)
+	began := time.Now()
+	for ii := 0; ii < 5; ii++ {
+		limit.wait()
+	}
+	if took := time.Since(began); took < 40*time.Millisecond {
+		t.Error("five queries at 100 a second should take 40ms, took", took)
+	}
+}
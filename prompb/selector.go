@@ -0,0 +1,215 @@
+package prompb
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseSelector turns a plain selector such as up{job="a",path=~"/x.*"} into
+// the matchers remote read takes. Anything else, such as an expression with
+// functions or a range, is not a plain selector.
+func ParseSelector(query string) ([]*LabelMatcher, bool) {
+	p := &selectorParser{in: strings.TrimSpace(query)}
+	out := make([]*LabelMatcher, 0)
+	if name := p.name(); name != "" {
+		out = append(out, &LabelMatcher{Type: MatchEqual, Name: "__name__", Value: name})
+	}
+	if p.done() {
+		return out, len(out) > 0
+	}
+	if !p.take("{") {
+		return nil, false
+	}
+	for !p.take("}") {
+		matcher, ok := p.matcher()
+		if !ok {
+			return nil, false
+		}
+		out = append(out, matcher)
+		if !p.take(",") && !p.peek("}") {
+			return nil, false
+		}
+	}
+	return out, p.done() && len(out) > 0
+}
+
+// Selector is a plain selector ready to be matched against the labels of
+// series.
+type Selector struct {
+	Matchers []*LabelMatcher
+	regexps  []*regexp.Regexp
+}
+
+// CompileSelector parses a plain selector and compiles its regular expressions.
+func CompileSelector(query string) (*Selector, bool) {
+	matchers, ok := ParseSelector(query)
+	if !ok {
+		return nil, false
+	}
+	out := &Selector{matchers, make([]*regexp.Regexp, len(matchers))}
+	for ii, xx := range matchers {
+		if xx.Type == MatchRegexp || xx.Type == MatchNotRegexp {
+			out.regexps[ii], _ = anchored(xx.Value)
+		}
+	}
+	return out, true
+}
+
+// Matches tells whether labels satisfy every matcher. A missing label
+// matches as if it were empty, as it does in prometheus.
+func (s *Selector) Matches(labels map[string]string) bool {
+	for ii, xx := range s.Matchers {
+		val := labels[xx.Name]
+		var ok bool
+		switch xx.Type {
+		case MatchEqual:
+			ok = val == xx.Value
+		case MatchNotEqual:
+			ok = val != xx.Value
+		case MatchRegexp:
+			ok = s.regexps[ii].MatchString(val)
+		case MatchNotRegexp:
+			ok = !s.regexps[ii].MatchString(val)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// anchored compiles a regular expression that has to match a whole value.
+func anchored(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+// selectorParser walks through a selector.
+type selectorParser struct {
+	in  string
+	pos int
+}
+
+func (p *selectorParser) skip() {
+	for p.pos < len(p.in) && unicode.IsSpace(rune(p.in[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *selectorParser) done() bool {
+	p.skip()
+	return p.pos == len(p.in)
+}
+
+func (p *selectorParser) peek(token string) bool {
+	p.skip()
+	return strings.HasPrefix(p.in[p.pos:], token)
+}
+
+func (p *selectorParser) take(token string) bool {
+	if p.peek(token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// name reads a metric or label name, or nothing if there is none.
+func (p *selectorParser) name() string {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.in) {
+		ch := p.in[p.pos]
+		if ch == '_' || ch == ':' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || p.pos > start && '0' <= ch && ch <= '9' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.in[start:p.pos]
+}
+
+func (p *selectorParser) matcher() (*LabelMatcher, bool) {
+	name := p.name()
+	if name == "" {
+		return nil, false
+	}
+	var kind MatchType
+	switch {
+	case p.take("=~"):
+		kind = MatchRegexp
+	case p.take("!~"):
+		kind = MatchNotRegexp
+	case p.take("!="):
+		kind = MatchNotEqual
+	case p.take("="):
+		kind = MatchEqual
+	default:
+		return nil, false
+	}
+	value, ok := p.str()
+	if !ok {
+		return nil, false
+	}
+	if kind == MatchRegexp || kind == MatchNotRegexp {
+		if _, err := anchored(value); err != nil {
+			return nil, false
+		}
+	}
+	return &LabelMatcher{Type: kind, Name: name, Value: value}, true
+}
+
+// str reads a quoted string, with the escapes PromQL allows.
+func (p *selectorParser) str() (string, bool) {
+	p.skip()
+	if p.pos >= len(p.in) {
+		return "", false
+	}
+	quote := p.in[p.pos]
+	if quote != '"' && quote != '\'' && quote != '`' {
+		return "", false
+	}
+	end := p.pos + 1
+	for end < len(p.in) && p.in[end] != quote {
+		if p.in[end] == '\\' && quote != '`' {
+			end++
+		}
+		end++
+	}
+	if end >= len(p.in) {
+		return "", false
+	}
+	inner := p.in[p.pos+1 : end]
+	p.pos = end + 1
+	if quote == '`' {
+		return inner, true
+	}
+	if quote == '\'' {
+		inner = requote(inner)
+	}
+	out, err := strconv.Unquote(`"` + inner + `"`)
+	return out, err == nil
+}
+
+// requote turns the inside of a single quoted string into the inside of a
+// double quoted one.
+func requote(in string) string {
+	var out bytes.Buffer
+	for ii := 0; ii < len(in); ii++ {
+		switch {
+		case in[ii] == '\\' && ii+1 < len(in) && in[ii+1] == '\'':
+			out.WriteByte('\'')
+			ii++
+		case in[ii] == '\\' && ii+1 < len(in):
+			out.WriteString(in[ii : ii+2])
+			ii++
+		case in[ii] == '"':
+			out.WriteString(`\"`)
+		default:
+			out.WriteByte(in[ii])
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,54 @@
+package prompb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	good := map[string]string{
+		`up`:                      `[__name__=up]`,
+		` {job="a"} `:             `[job=a]`,
+		`up{job=~"a.*",}`:         `[__name__=up job=~a.*]`,
+		`{a!="x\"y", b!~'z\'s"'}`: `[a!=x"y b!~z's"]`,
+		"node:cpu{path=`/x\\d`}":  `[__name__=node:cpu path=/x\d]`,
+		`{region="Zürich"}`:       `[region=Zürich]`,
+	}
+	ops := map[MatchType]string{MatchEqual: "=", MatchNotEqual: "!=", MatchRegexp: "=~", MatchNotRegexp: "!~"}
+	for in, want := range good {
+		matchers, ok := ParseSelector(in)
+		got := make([]string, len(matchers))
+		for ii, xx := range matchers {
+			got[ii] = xx.Name + ops[xx.Type] + xx.Value
+		}
+		if !ok || fmt.Sprint(got) != want {
+			t.Error(in, ok, fmt.Sprint(got))
+		}
+	}
+	for _, in := range []string{`rate(up[5m])`, `up[5m]`, `sum(up)`, `up offset 5m`, `{}`, `{job=~"("}`, `{job="a"`, `{job=a}`, `up{job="a"} + 1`, ``} {
+		if _, ok := ParseSelector(in); ok {
+			t.Error("not a plain selector:", in)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	sel, ok := CompileSelector(`up{job=~"api|web",env!="dev",zone!~"eu-.*",team=""}`)
+	if !ok {
+		t.Fatal("selector did not compile")
+	}
+	labels := map[string]string{"__name__": "up", "job": "api", "env": "prod", "zone": "us-1"}
+	if !sel.Matches(labels) {
+		t.Error("should match", labels)
+	}
+	for key, val := range map[string]string{"__name__": "down", "job": "apis", "env": "dev", "zone": "eu-2", "team": "x"} {
+		changed := map[string]string{}
+		for kk, vv := range labels {
+			changed[kk] = vv
+		}
+		changed[key] = val
+		if sel.Matches(changed) {
+			t.Error("should not match", changed)
+		}
+	}
+}
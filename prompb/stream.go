@@ -0,0 +1,69 @@
+package prompb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// ContentTypeSamples is the content type of a snappy compressed ReadResponse.
+	ContentTypeSamples = "application/x-protobuf"
+	// ContentTypeStreamed is the content type of a stream of ChunkedReadResponse frames.
+	ContentTypeStreamed = "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse"
+	// maxFrame is the largest frame read; prometheus sends frames of about a megabyte.
+	maxFrame = 50 << 20
+)
+
+var (
+	castagnoli   = crc32.MakeTable(crc32.Castagnoli)
+	errFrameSize = errors.New("frame too large")
+)
+
+// WriteFrame writes one frame of a streamed response: the length of msg as a
+// uvarint, its CRC32 (Castagnoli) as four big endian bytes, then msg itself.
+func WriteFrame(w io.Writer, msg []byte) error {
+	var head [binary.MaxVarintLen64 + 4]byte
+	size := binary.PutUvarint(head[:], uint64(len(msg)))
+	binary.BigEndian.PutUint32(head[size:], crc32.Checksum(msg, castagnoli))
+	if _, err := w.Write(head[:size+4]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// ReadFrame reads the next frame written by WriteFrame, returning io.EOF once
+// the stream ends between frames.
+func ReadFrame(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxFrame {
+		return nil, fmt.Errorf("%v: %d bytes", errFrameSize, size)
+	}
+	var sum [4]byte
+	if _, err = io.ReadFull(r, sum[:]); err != nil {
+		return nil, unexpected(err)
+	}
+	msg := make([]byte, size)
+	if _, err = io.ReadFull(r, msg); err != nil {
+		return nil, unexpected(err)
+	}
+	if got, want := crc32.Checksum(msg, castagnoli), binary.BigEndian.Uint32(sum[:]); got != want {
+		return nil, fmt.Errorf("frame checksum mismatch: got %x, want %x", got, want)
+	}
+	return msg, nil
+}
+
+// unexpected turns the end of the stream in the middle of a frame into an error.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,194 @@
+// Package prompb holds the protocol buffer messages of the prometheus remote
+// read and write protocols. They are written out by hand after
+// github.com/prometheus/prometheus/prompb, keeping its field numbers, so they
+// marshal with github.com/golang/protobuf without generated code.
+package prompb
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// Sample is one value of a series at a time in milliseconds.
+type Sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3"`
+}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()    {}
+
+// Label is one name and value of the labels of a series.
+type Label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+
+// TimeSeries is a labelled run of samples.
+type TimeSeries struct {
+	Labels  []*Label  `protobuf:"bytes,1,rep,name=labels,proto3"`
+	Samples []*Sample `protobuf:"bytes,2,rep,name=samples,proto3"`
+}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()    {}
+
+// LabelMap turns the labels of a series into a map.
+func (m *TimeSeries) LabelMap() map[string]string {
+	return labelMap(m.Labels)
+}
+
+func labelMap(labels []*Label) map[string]string {
+	out := make(map[string]string, len(labels))
+	for _, xx := range labels {
+		out[xx.Name] = xx.Value
+	}
+	return out
+}
+
+// MatchType is how a LabelMatcher compares a label with its value.
+type MatchType int32
+
+// The ways a label can be matched, as in =, !=, =~ and !~.
+const (
+	MatchEqual MatchType = iota
+	MatchNotEqual
+	MatchRegexp
+	MatchNotRegexp
+)
+
+// LabelMatcher selects series by one of their labels.
+type LabelMatcher struct {
+	Type  MatchType `protobuf:"varint,1,opt,name=type,proto3,enum=prometheus.LabelMatcher_Type"`
+	Name  string    `protobuf:"bytes,2,opt,name=name,proto3"`
+	Value string    `protobuf:"bytes,3,opt,name=value,proto3"`
+}
+
+func (m *LabelMatcher) Reset()         { *m = LabelMatcher{} }
+func (m *LabelMatcher) String() string { return proto.CompactTextString(m) }
+func (*LabelMatcher) ProtoMessage()    {}
+
+// ReadHints tell the remote end what the samples will be used for.
+type ReadHints struct {
+	StepMs  int64  `protobuf:"varint,1,opt,name=step_ms,json=stepMs,proto3"`
+	Func    string `protobuf:"bytes,2,opt,name=func,proto3"`
+	StartMs int64  `protobuf:"varint,3,opt,name=start_ms,json=startMs,proto3"`
+	EndMs   int64  `protobuf:"varint,4,opt,name=end_ms,json=endMs,proto3"`
+}
+
+func (m *ReadHints) Reset()         { *m = ReadHints{} }
+func (m *ReadHints) String() string { return proto.CompactTextString(m) }
+func (*ReadHints) ProtoMessage()    {}
+
+// Query asks for the samples of the series matching all of its matchers
+// between two times in milliseconds.
+type Query struct {
+	StartTimestampMs int64           `protobuf:"varint,1,opt,name=start_timestamp_ms,json=startTimestampMs,proto3"`
+	EndTimestampMs   int64           `protobuf:"varint,2,opt,name=end_timestamp_ms,json=endTimestampMs,proto3"`
+	Matchers         []*LabelMatcher `protobuf:"bytes,3,rep,name=matchers,proto3"`
+	Hints            *ReadHints      `protobuf:"bytes,4,opt,name=hints,proto3"`
+}
+
+func (m *Query) Reset()         { *m = Query{} }
+func (m *Query) String() string { return proto.CompactTextString(m) }
+func (*Query) ProtoMessage()    {}
+
+// ResponseType is a form of answer a ReadRequest accepts.
+type ResponseType int32
+
+const (
+	// Samples is a single snappy compressed ReadResponse.
+	Samples ResponseType = 0
+	// StreamedXORChunks is a stream of ChunkedReadResponse frames.
+	StreamedXORChunks ResponseType = 1
+)
+
+// WriteRequest is what a remote write pushes. Metadata, field 3, is not
+// used and is skipped when unmarshalling.
+type WriteRequest struct {
+	Timeseries []*TimeSeries `protobuf:"bytes,1,rep,name=timeseries,proto3"`
+}
+
+func (m *WriteRequest) Reset()         { *m = WriteRequest{} }
+func (m *WriteRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteRequest) ProtoMessage()    {}
+
+// ReadRequest is what a remote read sends.
+type ReadRequest struct {
+	Queries               []*Query       `protobuf:"bytes,1,rep,name=queries,proto3"`
+	AcceptedResponseTypes []ResponseType `protobuf:"varint,2,rep,packed,name=accepted_response_types,json=acceptedResponseTypes,proto3,enum=prometheus.ReadRequest_ResponseType"`
+}
+
+func (m *ReadRequest) Reset()         { *m = ReadRequest{} }
+func (m *ReadRequest) String() string { return proto.CompactTextString(m) }
+func (*ReadRequest) ProtoMessage()    {}
+
+// QueryResult holds the series one Query matched.
+type QueryResult struct {
+	Timeseries []*TimeSeries `protobuf:"bytes,1,rep,name=timeseries,proto3"`
+}
+
+func (m *QueryResult) Reset()         { *m = QueryResult{} }
+func (m *QueryResult) String() string { return proto.CompactTextString(m) }
+func (*QueryResult) ProtoMessage()    {}
+
+// ReadResponse answers a ReadRequest with one result per query.
+type ReadResponse struct {
+	Results []*QueryResult `protobuf:"bytes,1,rep,name=results,proto3"`
+}
+
+func (m *ReadResponse) Reset()         { *m = ReadResponse{} }
+func (m *ReadResponse) String() string { return proto.CompactTextString(m) }
+func (*ReadResponse) ProtoMessage()    {}
+
+// ChunkEncoding is how the samples of a chunk are packed.
+type ChunkEncoding int32
+
+const (
+	// EncodingUnknown chunks cannot be read.
+	EncodingUnknown ChunkEncoding = 0
+	// EncodingXOR chunks are packed as in DecodeXOR.
+	EncodingXOR ChunkEncoding = 1
+)
+
+// Chunk is a packed run of samples.
+type Chunk struct {
+	MinTimeMs int64         `protobuf:"varint,1,opt,name=min_time_ms,json=minTimeMs,proto3"`
+	MaxTimeMs int64         `protobuf:"varint,2,opt,name=max_time_ms,json=maxTimeMs,proto3"`
+	Type      ChunkEncoding `protobuf:"varint,3,opt,name=type,proto3,enum=prometheus.Chunk_Encoding"`
+	Data      []byte        `protobuf:"bytes,4,opt,name=data,proto3"`
+}
+
+func (m *Chunk) Reset()         { *m = Chunk{} }
+func (m *Chunk) String() string { return proto.CompactTextString(m) }
+func (*Chunk) ProtoMessage()    {}
+
+// ChunkedSeries is a series whose samples come in chunks.
+type ChunkedSeries struct {
+	Labels []*Label `protobuf:"bytes,1,rep,name=labels,proto3"`
+	Chunks []*Chunk `protobuf:"bytes,2,rep,name=chunks,proto3"`
+}
+
+func (m *ChunkedSeries) Reset()         { *m = ChunkedSeries{} }
+func (m *ChunkedSeries) String() string { return proto.CompactTextString(m) }
+func (*ChunkedSeries) ProtoMessage()    {}
+
+// LabelMap turns the labels of a series into a map.
+func (m *ChunkedSeries) LabelMap() map[string]string {
+	return labelMap(m.Labels)
+}
+
+// ChunkedReadResponse is one frame of a streamed answer to a ReadRequest.
+type ChunkedReadResponse struct {
+	ChunkedSeries []*ChunkedSeries `protobuf:"bytes,1,rep,name=chunked_series,json=chunkedSeries,proto3"`
+	QueryIndex    int64            `protobuf:"varint,2,opt,name=query_index,json=queryIndex,proto3"`
+}
+
+func (m *ChunkedReadResponse) Reset()         { *m = ChunkedReadResponse{} }
+func (m *ChunkedReadResponse) String() string { return proto.CompactTextString(m) }
+func (*ChunkedReadResponse) ProtoMessage()    {}
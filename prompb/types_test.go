@@ -0,0 +1,98 @@
+package prompb
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestMarshal(t *testing.T) {
+	req := &ReadRequest{
+		Queries: []*Query{{
+			StartTimestampMs: 1000,
+			EndTimestampMs:   2000,
+			Matchers:         []*LabelMatcher{{Type: MatchRegexp, Name: "job", Value: "a.*"}},
+			Hints:            &ReadHints{StepMs: 10000},
+		}},
+		AcceptedResponseTypes: []ResponseType{StreamedXORChunks, Samples},
+	}
+	out, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back ReadRequest
+	if err = proto.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(req, &back) || back.Queries[0].Matchers[0].Type != MatchRegexp {
+		t.Error(back.String())
+	}
+
+	series := &TimeSeries{Labels: []*Label{{"__name__", "up"}}, Samples: []*Sample{{1.5, 1000}}}
+	if g := series.LabelMap(); g["__name__"] != "up" {
+		t.Error(g)
+	}
+}
+
+func TestXOR(t *testing.T) {
+	cases := map[string][]Sample{
+		"empty":   {},
+		"single":  {{42, 1000}},
+		"regular": {{1, 1000}, {2, 11000}, {3, 21000}, {3, 31000}, {4, 41000}},
+		"jitter":  {{0.5, -5}, {0.25, 15005}, {1e9, 29990}, {-3, 45000}, {math.Inf(1), 45001}, {7, 1e12}, {7.25, 1e12 + 3}},
+	}
+	long := make([]Sample, 200)
+	for ii := range long {
+		long[ii] = Sample{math.Sin(float64(ii)) * 1000, int64(ii*ii*37 + ii%3)}
+	}
+	cases["long"] = long
+	for name, samples := range cases {
+		got, err := DecodeXOR(EncodeXOR(samples))
+		if err != nil || len(got) != len(samples) {
+			t.Error(name, err, got)
+			continue
+		}
+		for ii := range got {
+			if got[ii] != samples[ii] {
+				t.Error(name, ii, got[ii], samples[ii])
+				break
+			}
+		}
+	}
+	if _, err := DecodeXOR(EncodeXOR(long)[:50]); err == nil {
+		t.Error("a cut short chunk should fail")
+	}
+}
+
+func TestFrames(t *testing.T) {
+	var buf bytes.Buffer
+	WriteFrame(&buf, []byte("first"))
+	WriteFrame(&buf, []byte{})
+	WriteFrame(&buf, []byte("third"))
+	r := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	for _, want := range []string{"first", "", "third"} {
+		if got, err := ReadFrame(r); err != nil || string(got) != want {
+			t.Error(want, string(got), err)
+		}
+	}
+	if _, err := ReadFrame(r); err != io.EOF {
+		t.Error(err)
+	}
+
+	broken := append([]byte{}, buf.Bytes()...)
+	broken[len(broken)-1] ^= 0xff
+	r = bufio.NewReader(bytes.NewReader(broken[:len(broken)]))
+	ReadFrame(r)
+	ReadFrame(r)
+	if _, err := ReadFrame(r); err == nil {
+		t.Error("a corrupt frame should fail its checksum")
+	}
+	r = bufio.NewReader(bytes.NewReader(buf.Bytes()[:3]))
+	if _, err := ReadFrame(r); err != io.ErrUnexpectedEOF {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,268 @@
+package prompb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// The samples of an XOR chunk are packed as prometheus packs them on disk: a
+// two byte count, the first timestamp and value in full, then timestamps as
+// the change in their distance apart and values XORed with the one before.
+
+var errChunkEnd = errors.New("xor chunk ends early")
+
+// bitWriter appends bits to a byte slice.
+type bitWriter struct {
+	out   []byte
+	count uint8 // bits free in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.count == 0 {
+		w.out = append(w.out, 0)
+		w.count = 8
+	}
+	w.count--
+	if bit {
+		w.out[len(w.out)-1] |= 1 << w.count
+	}
+}
+
+func (w *bitWriter) writeBits(val uint64, nbits int) {
+	for ii := nbits - 1; ii >= 0; ii-- {
+		w.writeBit(val>>uint(ii)&1 == 1)
+	}
+}
+
+func (w *bitWriter) writeBytes(in []byte) {
+	for _, xx := range in {
+		w.writeBits(uint64(xx), 8)
+	}
+}
+
+// bitReader reads bits off a byte slice.
+type bitReader struct {
+	in  []byte
+	pos int // bits read so far
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.in)*8 {
+		return false, errChunkEnd
+	}
+	bit := r.in[r.pos/8]>>(7-uint(r.pos%8))&1 == 1
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(nbits int) (uint64, error) {
+	var out uint64
+	for ii := 0; ii < nbits; ii++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		out <<= 1
+		if bit {
+			out |= 1
+		}
+	}
+	return out, nil
+}
+
+// ReadByte lets varints be read straight off the bits.
+func (r *bitReader) ReadByte() (byte, error) {
+	val, err := r.readBits(8)
+	return byte(val), err
+}
+
+// dodBuckets are the widths a change in distance between timestamps is
+// written in, after a prefix of as many one bits as the bucket's place.
+var dodBuckets = []int{14, 17, 20}
+
+// EncodeXOR packs samples into an XOR chunk.
+func EncodeXOR(samples []Sample) []byte {
+	w := &bitWriter{}
+	w.writeBits(uint64(len(samples)), 16)
+	var (
+		buf                [binary.MaxVarintLen64]byte
+		prevTime, prevDiff int64
+		prevVal            uint64
+		// no values were written yet, so the first change always comes in full
+		leading, trailing = 0xff, 0
+	)
+	for ii, xx := range samples {
+		val := math.Float64bits(xx.Value)
+		switch ii {
+		case 0:
+			w.writeBytes(buf[:binary.PutVarint(buf[:], xx.Timestamp)])
+			w.writeBits(val, 64)
+		case 1:
+			prevDiff = xx.Timestamp - prevTime
+			w.writeBytes(buf[:binary.PutUvarint(buf[:], uint64(prevDiff))])
+			leading, trailing = writeXOR(w, val^prevVal, leading, trailing)
+		default:
+			diff := xx.Timestamp - prevTime
+			writeDod(w, diff-prevDiff)
+			prevDiff = diff
+			leading, trailing = writeXOR(w, val^prevVal, leading, trailing)
+		}
+		prevTime, prevVal = xx.Timestamp, val
+	}
+	return w.out
+}
+
+func writeDod(w *bitWriter, dod int64) {
+	if dod == 0 {
+		w.writeBit(false)
+		return
+	}
+	for ii, width := range dodBuckets {
+		if -(1<<uint(width-1))+1 <= dod && dod <= 1<<uint(width-1) {
+			w.writeBits(1<<uint(ii+2)-2, ii+2)
+			w.writeBits(uint64(dod), width)
+			return
+		}
+	}
+	w.writeBits(0x0f, 4)
+	w.writeBits(uint64(dod), 64)
+}
+
+func writeXOR(w *bitWriter, delta uint64, leading, trailing int) (int, int) {
+	if delta == 0 {
+		w.writeBit(false)
+		return leading, trailing
+	}
+	w.writeBit(true)
+	newLeading, newTrailing := bits.LeadingZeros64(delta), bits.TrailingZeros64(delta)
+	if newLeading >= 32 {
+		newLeading = 31
+	}
+	if newLeading >= leading && newTrailing >= trailing {
+		w.writeBit(false)
+		w.writeBits(delta>>uint(trailing), 64-leading-trailing)
+		return leading, trailing
+	}
+	sigbits := 64 - newLeading - newTrailing
+	w.writeBit(true)
+	w.writeBits(uint64(newLeading), 5)
+	// 64 significant bits do not fit in six, and 0 never happens, so 0 stands for 64
+	w.writeBits(uint64(sigbits), 6)
+	w.writeBits(delta>>uint(newTrailing), sigbits)
+	return newLeading, newTrailing
+}
+
+// DecodeXOR unpacks the samples of an XOR chunk.
+func DecodeXOR(data []byte) ([]Sample, error) {
+	if len(data) < 2 {
+		return nil, errChunkEnd
+	}
+	count := int(binary.BigEndian.Uint16(data))
+	r := &bitReader{in: data, pos: 16}
+	out := make([]Sample, 0, count)
+	var (
+		prevTime, prevDiff int64
+		prevVal            uint64
+		leading, trailing  int
+	)
+	for ii := 0; ii < count; ii++ {
+		switch ii {
+		case 0:
+			ts, err := binary.ReadVarint(r)
+			if err != nil {
+				return out, err
+			}
+			val, err := r.readBits(64)
+			if err != nil {
+				return out, err
+			}
+			prevTime, prevVal = ts, val
+		case 1:
+			diff, err := binary.ReadUvarint(r)
+			if err != nil {
+				return out, err
+			}
+			prevDiff = int64(diff)
+			prevTime += prevDiff
+			if prevVal, leading, trailing, err = readXOR(r, prevVal, leading, trailing); err != nil {
+				return out, err
+			}
+		default:
+			dod, err := readDod(r)
+			if err != nil {
+				return out, err
+			}
+			prevDiff += dod
+			prevTime += prevDiff
+			if prevVal, leading, trailing, err = readXOR(r, prevVal, leading, trailing); err != nil {
+				return out, err
+			}
+		}
+		out = append(out, Sample{Value: math.Float64frombits(prevVal), Timestamp: prevTime})
+	}
+	return out, nil
+}
+
+func readDod(r *bitReader) (int64, error) {
+	ones := 0
+	for ones <= len(dodBuckets) {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		ones++
+	}
+	switch {
+	case ones == 0:
+		return 0, nil
+	case ones <= len(dodBuckets):
+		return readWidth(r, dodBuckets[ones-1])
+	}
+	return readWidth(r, 64)
+}
+
+func readWidth(r *bitReader, width int) (int64, error) {
+	val, err := r.readBits(width)
+	if err != nil {
+		return 0, err
+	}
+	if width != 64 && val > 1<<uint(width-1) {
+		val -= 1 << uint(width)
+	}
+	return int64(val), nil
+}
+
+func readXOR(r *bitReader, prev uint64, leading, trailing int) (uint64, int, int, error) {
+	changed, err := r.readBit()
+	if err != nil || !changed {
+		return prev, leading, trailing, err
+	}
+	fresh, err := r.readBit()
+	if err != nil {
+		return prev, leading, trailing, err
+	}
+	if fresh {
+		lead, err := r.readBits(5)
+		if err != nil {
+			return prev, leading, trailing, err
+		}
+		sigbits, err := r.readBits(6)
+		if err != nil {
+			return prev, leading, trailing, err
+		}
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		leading, trailing = int(lead), 64-int(lead)-int(sigbits)
+	}
+	delta, err := r.readBits(64 - leading - trailing)
+	if err != nil {
+		return prev, leading, trailing, err
+	}
+	return prev ^ delta<<uint(trailing), leading, trailing, nil
+}
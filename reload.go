@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/icarus"
+	"github.com/open-fresh/data-sidecar/prom"
+	"github.com/open-fresh/data-sidecar/storage"
+	"github.com/open-fresh/data-sidecar/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	reloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sidecar_config_last_reload_successful",
+		Help: "Whether the last configuration reload attempt was successful."})
+	reloadSuccessTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sidecar_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload."})
+	reloadCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_config_reloads_total",
+		Help: "Number of configuration reloads by result"},
+		[]string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(reloadSuccess)
+	prometheus.MustRegister(reloadSuccessTime)
+	prometheus.MustRegister(reloadCounter)
+}
+
+// reloader re-reads the configuration and applies it to the running pieces of the sidecar.
+type reloader struct {
+	*sync.Mutex
+	cfg      config.Config
+	load     func() (config.Config, error)
+	tenants  map[string]*tenant
+	store    *storage.Store
+	remote   *icarus.Icarus
+	receiver *prom.Receiver
+}
+
+// newReloader wraps the running pieces of the sidecar, which were built from
+// cfg. Tenants are keyed by their id.
+func newReloader(cfg config.Config, load func() (config.Config, error),
+	tenants map[string]*tenant, store *storage.Store, remote *icarus.Icarus, receiver *prom.Receiver) *reloader {
+	var mux sync.Mutex
+	reloadSuccess.Set(1)
+	reloadSuccessTime.SetToCurrentTime()
+	return &reloader{&mux, cfg, load, tenants, store, remote, receiver}
+}
+
+// Config returns the configuration currently running.
+func (r *reloader) Config() config.Config {
+	r.Lock()
+	defer r.Unlock()
+	return r.cfg
+}
+
+// Reload loads the configuration again and reconciles the running pieces with it.
+// New tenants start fetching; dropped tenants stop and their series are
+// forgotten. When loading fails the old configuration keeps running.
+func (r *reloader) Reload() error {
+	r.Lock()
+	defer r.Unlock()
+	cfg, err := r.load()
+	if err == nil {
+		err = clientAuth(cfg).Check()
+	}
+	if err == nil {
+		err = r.receiver.SetSelectors(cfg.ReceiveSelectors())
+	}
+	if err != nil {
+		reloadSuccess.Set(0)
+		reloadCounter.WithLabelValues("failure").Inc()
+		return err
+	}
+	var reset []string
+	wanted := make(map[string]bool)
+	for _, settings := range cfg.TenantList() {
+		wanted[settings.ID] = true
+		if running, ok := r.tenants[settings.ID]; ok {
+			reset = append(reset, running.apply(cfg, settings)...)
+			continue
+		}
+		started := newTenant(cfg, settings, r.store, r.remote)
+		started.client.Start()
+		r.receiver.SetScorer(settings.ID, started.scorer)
+		r.tenants[settings.ID] = started
+	}
+	for id, running := range r.tenants {
+		if !wanted[id] {
+			running.client.Close()
+			r.receiver.SetScorer(id, nil)
+			r.store.PruneLabel(util.TenantLabel, id)
+			delete(r.tenants, id)
+		}
+	}
+	r.store.SetLengths(cfg.RingLength, cfg.LengthsBySelector())
+	r.receiver.SetStep(cfg.Resolution)
+	configureExport(r.remote, cfg)
+	r.cfg = cfg
+	reloadSuccess.Set(1)
+	reloadSuccessTime.SetToCurrentTime()
+	reloadCounter.WithLabelValues("success").Inc()
+	log.Println("configuration reloaded, reset series of selectors", reset)
+	return nil
+}
+
+// ScoreHandleFunc scores data with the scorer of the tenant named by the
+// tenant parameter, or of the first tenant configured when there is none.
+func (r *reloader) ScoreHandleFunc(w http.ResponseWriter, req *http.Request) {
+	id := req.FormValue("tenant")
+	r.Lock()
+	if id == "" {
+		id = r.cfg.TenantList()[0].ID
+	}
+	running, ok := r.tenants[id]
+	r.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "unknown tenant %q", id)
+		return
+	}
+	running.scorer.ScoreHandleFunc(w, req)
+}
+
+// Watch reloads whenever the process gets a SIGHUP.
+func (r *reloader) Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := r.Reload(); err != nil {
+				log.Println("error reloading configuration:", err)
+			}
+		}
+	}()
+}
+
+// HandleFunc reloads on POST /-/reload.
+func (r *reloader) HandleFunc(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprint(w, "Only POST requests allowed")
+		return
+	}
+	if err := r.Reload(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to reload config: %s", err)
+		return
+	}
+	fmt.Fprint(w, "configuration reloaded")
+}
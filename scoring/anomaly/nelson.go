@@ -18,6 +18,12 @@ func anomalyLabels(labels map[string]string, model string) map[string]string {
 	return anomalyLabels
 }
 
+// Labels are the labels an anomaly fired by model on a series is recorded
+// under, for models that keep their own state outside this package.
+func Labels(labels map[string]string, model string) map[string]string {
+	return anomalyLabels(labels, model)
+}
+
 func anomalyHelper(aName string, fire bool, name map[string]string, record *[]map[string]string) {
 	// this once did more, and could again...
 	if fire {
@@ -25,31 +31,87 @@ func anomalyHelper(aName string, fire bool, name map[string]string, record *[]ma
 	}
 }
 
-// Nelson computes the nelson rules on a slice of data.
+// Rule is one of the nelson or western electric rules. It looks at the most
+// recent Points points of a window, given the mean and standard deviation of
+// the whole window.
+type Rule struct {
+	Points int
+	Check  func(data []float64, mean, std float64) bool
+}
+
+// DefaultRules are the rules run unless a group asks for others. Of the nelson
+// rules, we found that only these three really hold up in general as useful
+// indicators of anything.
+var DefaultRules = []string{"nelson_large_ooc", "nelson_medium_ooc", "nelson_small_ooc"}
+
+// Rules are all the rules that can be asked for, by the ft_model they fire as.
+var Rules = map[string]Rule{
+	"nelson_large_ooc": {1, func(data []float64, mean, std float64) bool {
+		return NelsonLargeOoC(data, mean-3*std, mean+3*std)
+	}},
+	"nelson_bias": {9, func(data []float64, mean, std float64) bool {
+		return OneSide(data, mean, 9)
+	}},
+	"nelson_trend": {6, func(data []float64, mean, std float64) bool {
+		return NelsonTrend(data)
+	}},
+	"nelson_oscillation": {14, func(data []float64, mean, std float64) bool {
+		return NelsonOscillation(data)
+	}},
+	"nelson_medium_ooc": {3, func(data []float64, mean, std float64) bool {
+		return NelsonMediumOoC(data, mean-2*std, mean+2*std)
+	}},
+	"nelson_small_ooc": {5, func(data []float64, mean, std float64) bool {
+		return NelsonSmallOoC(data, mean-std, mean+std)
+	}},
+	"nelson_stratification": {15, func(data []float64, mean, std float64) bool {
+		return NelsonStratification(data, mean-std, mean+std)
+	}},
+	"nelson_mixture": {8, func(data []float64, mean, std float64) bool {
+		return NelsonMixture(data, mean-std, mean+std)
+	}},
+	// the western electric rules are the first three nelson rules with a
+	// shorter run on one side of the mean.
+	"western_electric_1": {1, func(data []float64, mean, std float64) bool {
+		return NelsonLargeOoC(data, mean-3*std, mean+3*std)
+	}},
+	"western_electric_2": {3, func(data []float64, mean, std float64) bool {
+		return NelsonMediumOoC(data, mean-2*std, mean+2*std)
+	}},
+	"western_electric_3": {5, func(data []float64, mean, std float64) bool {
+		return NelsonSmallOoC(data, mean-std, mean+std)
+	}},
+	"western_electric_4": {8, func(data []float64, mean, std float64) bool {
+		return OneSide(data, mean, 8)
+	}},
+}
+
+// Nelson computes the default nelson rules on a slice of data.
 func Nelson(data []float64, name map[string]string) []map[string]string {
+	return NelsonRules(data, name, DefaultRules)
+}
+
+// NelsonRules computes the named rules on a slice of data. Names that are not
+// in Rules are skipped.
+func NelsonRules(data []float64, name map[string]string, rules []string) []map[string]string {
 	// need enough information to do nelson rules on.
 	// calculate quantiles instead of using the mean+std approach.
-	var (
-		mean, std = stat.MeanStdDev(data)
-		mm3sd     = mean - 3*std
-		mm2sd     = mean - 2*std
-		mm1sd     = mean - 1*std
-		mp1sd     = mean + 1*std
-		mp2sd     = mean + 2*std
-		mp3sd     = mean + 3*std
-	)
+	mean, std := stat.MeanStdDev(data)
 	record := make([]map[string]string, 0)
-	// of the nelson rules, we found that only these three really hold up in general as useful
-	// indicators of anything.
-	anomalyHelper("nelson_large_ooc", NelsonLargeOoC(data, mm3sd, mp3sd), name, &record)
-	anomalyHelper("nelson_medium_ooc", NelsonMediumOoC(data, mm2sd, mp2sd), name, &record)
-	anomalyHelper("nelson_small_ooc", NelsonSmallOoC(data, mm1sd, mp1sd), name, &record)
+	for _, rule := range rules {
+		if check, ok := Rules[rule]; ok {
+			anomalyHelper(rule, check.Check(data, mean, std), name, &record)
+		}
+	}
 	return record
 }
 
 // NelsonLargeOoC reports if the most recent point is outside of the
 // equivalent of 3sds of the mean
 func NelsonLargeOoC(data []float64, low, high float64) bool {
+	if len(data) < 1 {
+		return false
+	}
 	if low == high {
 		return false
 	}
@@ -112,3 +174,104 @@ func NelsonSmallOoC(data []float64, low, high float64) bool {
 	}
 	return false
 }
+
+// OneSide reports if the most recent run points are all above, or all below,
+// the mean.
+func OneSide(data []float64, mean float64, run int) bool {
+	if len(data) < run {
+		return false
+	}
+	lows := 0
+	highs := 0
+	for ii := 0; ii < run; ii++ {
+		if data[len(data)-1-ii] < mean {
+			lows++
+		}
+		if data[len(data)-1-ii] > mean {
+			highs++
+		}
+	}
+	return lows == run || highs == run
+}
+
+// NelsonTrend reports if the most recent 6 points are steadily increasing
+// or steadily decreasing.
+func NelsonTrend(data []float64) bool {
+	if len(data) < 6 {
+		return false
+	}
+	ups := 0
+	downs := 0
+	for ii := len(data) - 5; ii < len(data); ii++ {
+		if data[ii] > data[ii-1] {
+			ups++
+		}
+		if data[ii] < data[ii-1] {
+			downs++
+		}
+	}
+	return ups == 5 || downs == 5
+}
+
+// NelsonOscillation reports if the most recent 14 points alternate up and
+// down.
+func NelsonOscillation(data []float64) bool {
+	if len(data) < 14 {
+		return false
+	}
+	for ii := len(data) - 13; ii < len(data); ii++ {
+		step := data[ii] - data[ii-1]
+		if step == 0 {
+			return false
+		}
+		if ii > len(data)-13 && (step > 0) == (data[ii-1] > data[ii-2]) {
+			return false
+		}
+	}
+	return true
+}
+
+// NelsonStratification reports if the most recent 15 points are all within
+// the equivalent of 1sd of the mean
+func NelsonStratification(data []float64, low, high float64) bool {
+	if len(data) < 15 {
+		return false
+	}
+	if low == high {
+		return false
+	}
+	// a flat line is within any spread, even the rounding error a constant
+	// series gets for a standard deviation.
+	varies := false
+	for ii := 0; ii < 15; ii++ {
+		if data[len(data)-1-ii] < low || data[len(data)-1-ii] > high {
+			return false
+		}
+		if data[len(data)-1-ii] != data[len(data)-1] {
+			varies = true
+		}
+	}
+	return varies
+}
+
+// NelsonMixture reports if the most recent 8 points are all outside of the
+// equivalent of 1sd of the mean, on both sides of it.
+func NelsonMixture(data []float64, low, high float64) bool {
+	if len(data) < 8 {
+		return false
+	}
+	if low == high {
+		return false
+	}
+	lows := 0
+	highs := 0
+	for ii := 0; ii < 8; ii++ {
+		if data[len(data)-1-ii] < low {
+			lows++
+		}
+		if data[len(data)-1-ii] > high {
+			highs++
+		}
+	}
+	return lows > 0 && highs > 0 && lows+highs == 8
+}
@@ -96,3 +96,49 @@ func TestNelson(t *testing.T) {
 		}
 	})
 }
+
+func TestRules(t *testing.T) {
+	fired := func(data []float64, rule string) bool {
+		for _, x := range NelsonRules(data, map[string]string{"__name__": "cpu"}, []string{rule}) {
+			if x["ft_model"] == rule && x["ft_metric"] == "cpu" {
+				return true
+			}
+		}
+		return false
+	}
+	flat := make([]float64, 30)
+	for ii := range flat {
+		flat[ii] = float64(ii % 3)
+	}
+	cases := []struct {
+		rule string
+		tail []float64
+	}{
+		{"nelson_bias", []float64{3, 3, 2.5, 3, 3, 2.5, 3, 3, 3}},
+		{"western_electric_4", []float64{3, 3, 2.5, 3, 3, 2.5, 3, 3}},
+		{"nelson_trend", []float64{-1, 0, 1, 2, 3, 4}},
+		{"nelson_oscillation", []float64{0, 2, 0, 2, 0, 2, 0, 2, 0, 2, 0, 2, 0, 2}},
+		{"nelson_stratification", []float64{1, 1.2, 1, 0.8, 1, 1.2, 1, 0.8, 1, 1.2, 1, 0.8, 1, 1.2, 1}},
+		{"nelson_mixture", []float64{-5, 7, -5, 7, -5, 7, -5, 7}},
+	}
+	for _, c := range cases {
+		if fired(flat, c.rule) {
+			t.Errorf("%s fired on steady data", c.rule)
+		}
+		data := append(append([]float64{}, flat...), c.tail...)
+		if !fired(data, c.rule) {
+			t.Errorf("%s did not fire on %v", c.rule, c.tail)
+		}
+	}
+	if fired([]float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, "nelson_stratification") {
+		t.Error("a constant series has no spread to stratify")
+	}
+	if len(NelsonRules(flat, map[string]string{}, []string{"no_such_rule"})) != 0 {
+		t.Error("unknown rules should be skipped")
+	}
+	for name, rule := range Rules {
+		if rule.Check(flat[:rule.Points-1], 0, 1) {
+			t.Errorf("%s fired with fewer than %d points", name, rule.Points)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package scoring
+
+import (
+	"math"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/scoring/anomaly"
+	"github.com/open-fresh/data-sidecar/stat"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// ChangePointState is the time the last level shift of a series started at,
+// or math.MinInt64 if none was seen.
+type ChangePointState struct {
+	Change int64
+}
+
+// NewChangePointState builds a state that has not seen a shift.
+func NewChangePointState() *ChangePointState {
+	return &ChangePointState{Change: math.MinInt64}
+}
+
+// Split finds the split of data into two segments of at least minSegment
+// points that explains the most of its variance, which is where a level shift
+// would be. It returns the index the second segment starts at and how far
+// apart the means of the segments are, in standard errors of their
+// difference, or -1 when data is too short to split.
+func Split(data []util.DataPoint, minSegment int) (int, float64) {
+	if len(data) < 2*minSegment {
+		return -1, 0
+	}
+	// the sums are taken around the first point to keep them small
+	offset := data[0].Val
+	left := stat.NewSuffStat()
+	right := stat.NewSuffStat()
+	for _, xx := range data {
+		right.Insert(xx.Val - offset)
+	}
+	best, bestBetween := -1, -1.0
+	var bestLeft, bestRight *stat.SuffStat
+	for ii := 0; ii <= len(data)-minSegment; ii++ {
+		if ii >= minSegment {
+			lmean, _ := left.MeanStdDev()
+			rmean, _ := right.MeanStdDev()
+			between := left.Count * right.Count * (lmean - rmean) * (lmean - rmean)
+			if between > bestBetween {
+				best, bestBetween = ii, between
+				bestLeft, bestRight = left.Copy(), right.Copy()
+			}
+		}
+		left.Insert(data[ii].Val - offset)
+		right.Remove(data[ii].Val - offset)
+	}
+
+	lmean, lstd := bestLeft.MeanStdDev()
+	rmean, rstd := bestRight.MeanStdDev()
+	pooled := (bestLeft.Count*lstd*lstd + bestRight.Count*rstd*rstd) / (bestLeft.Count + bestRight.Count - 2)
+	// a shift between two flat segments has no noise to measure it by
+	if !(pooled > 0) {
+		if lmean == rmean {
+			return best, 0
+		}
+		return best, math.Inf(1)
+	}
+	return best, math.Abs(lmean-rmean) / math.Sqrt(pooled*(1/bestLeft.Count+1/bestRight.Count))
+}
+
+// ChangePoint looks for a level shift in the points of a series since its last
+// one. It fires a changepoint anomaly when it finds one and drops what the
+// other models have learned about the series, and records when the latest shift
+// started as a threshold. It returns the points since the latest shift, which
+// is all the other models should draw their baseline from.
+func ChangePoint(data []util.DataPoint, kvs map[string]string, record util.Recorder,
+	storage util.StorageEngine, cfg config.ChangePointConfig) []util.DataPoint {
+
+	state, ok := storage.ModelState(kvs, "changepoint", func() interface{} {
+		return NewChangePointState()
+	}).(*ChangePointState)
+	if !ok || len(data) == 0 {
+		return data
+	}
+	curr := data[len(data)-1]
+	since := func() []util.DataPoint {
+		for ii, xx := range data {
+			if xx.Time >= state.Change {
+				return data[ii:]
+			}
+		}
+		return data[len(data):]
+	}
+
+	// a split against the newest points can still move as the shift gets more
+	// of them, so only a split with room after it is taken
+	recent := since()
+	if split, score := Split(recent, cfg.MinSegment); split >= 0 && split < len(recent)-cfg.MinSegment && score > cfg.Threshold {
+		state.Change = recent[split].Time
+		storage.ResetModelState(kvs, "changepoint", healthState)
+		record.Record(util.Metric{Desc: anomaly.Labels(kvs, "changepoint"), Data: util.DataPoint{Val: 1.0, Time: curr.Time}})
+	}
+	if state.Change != math.MinInt64 {
+		RecordThreshold(util.DataPoint{Val: float64(state.Change), Time: curr.Time}, kvs, "changepoint_time", record)
+	}
+	return since()
+}
@@ -0,0 +1,91 @@
+package scoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/storage"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+func TestSplit(t *testing.T) {
+	data := make([]util.DataPoint, 20)
+	noise := []float64{-1, 1, 0, 2, -2}
+	for ii := range data {
+		data[ii].Val = 1e9 + noise[ii%5]
+	}
+	if _, score := Split(data, 5); score > 3 {
+		t.Error("noise should not look like a shift", score)
+	}
+	for ii := 12; ii < 20; ii++ {
+		data[ii].Val += 10
+	}
+	if split, score := Split(data, 5); split != 12 || score < 6 {
+		t.Error(split, score)
+	}
+	if split, _ := Split(data[:9], 5); split != -1 {
+		t.Error("too short to split", split)
+	}
+	flat := []util.DataPoint{{Val: 1}, {Val: 1}, {Val: 1}, {Val: 2}, {Val: 2}, {Val: 2}}
+	if split, score := Split(flat, 3); split != 3 || score < 1e6 {
+		t.Error(split, score)
+	}
+}
+
+func TestChangePoint(t *testing.T) {
+	store := storage.NewStore()
+	kvs := map[string]string{"__name__": "latency"}
+	models := config.DefaultModels()
+	cp := config.DefaultChangePoint()
+	models.ChangePoint = &cp
+	score := func(val float64, ts int64) map[string]float64 {
+		store.Add(kvs, val, ts)
+		rec := util.NewRecorder()
+		ScoreItem(kvs, models, rec, store, nil)
+		close(rec.Chan)
+		out := make(map[string]float64)
+		for x := range rec.Chan {
+			out[x.Desc["__name__"]+x.Desc["ft_model"]] = x.Data.Val
+		}
+		return out
+	}
+	noise := []float64{-1, 1, 0, 2, -2}
+
+	ts := int64(0)
+	for ; ts < 30; ts++ {
+		if got := score(100+noise[ts%5], ts); got["anomalychangepoint"] != 0 {
+			t.Fatal("steady data should not shift", ts, got)
+		}
+	}
+	// a model that keeps failing stays backed off through the shift
+	in := &Input{Labels: kvs, Storage: store}
+	healthOf(in)["seasonal"] = &modelHealth{maxFailures, time.Now().Add(time.Hour)}
+	// a deploy moves the series to a new level
+	shift := ts
+	var got map[string]float64
+	for ; got["anomalychangepoint"] == 0 && ts < 50; ts++ {
+		got = score(150+noise[ts%5], ts)
+	}
+	if got["anomalychangepoint"] != 1 || got["changepoint_time:latency"] != float64(shift) {
+		t.Error("the shift was not found", ts, got)
+	}
+	if _, ok := got["high:latency"]; ok {
+		t.Error("the highway should start its baseline over", got)
+	}
+	if healthOf(in)["seasonal"] == nil {
+		t.Error("a shift should not bring back models that were backed off")
+	}
+	for ; ts < shift+40; ts++ {
+		got = score(150+noise[ts%5], ts)
+		if got["anomalychangepoint"] != 0 {
+			t.Error("the same shift should only be found once", ts, got)
+		}
+	}
+	if got["changepoint_time:latency"] != float64(shift) || got["high:latency"] > 160 || got["low:latency"] < 140 {
+		t.Error("the highway should be drawn around the new level", got)
+	}
+	if got["exitoutside"] == 1 {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,161 @@
+package scoring
+
+import (
+	"math"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/scoring/anomaly"
+	"github.com/open-fresh/data-sidecar/stat"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// ControlReference is the mean and standard deviation a control chart measures
+// a series against, learned from its first points.
+type ControlReference struct {
+	Warm  stat.SuffStat
+	First float64
+	Moved bool
+	Mean  float64
+	Std   float64
+	Ready bool
+	Last  int64
+}
+
+// Learn folds a warm-up value into the reference, which is ready once it has
+// seen warmup points with some spread to them. A series that has not moved
+// yet keeps warming up, since it has nothing to measure drift against.
+func (r *ControlReference) Learn(val float64, warmup int) {
+	if r.Warm.Count == 0 {
+		r.First = val
+	}
+	// the sufficient statistic never gives exactly zero spread, so look for it directly
+	r.Moved = r.Moved || val != r.First
+	r.Warm.Insert(val)
+	if int(r.Warm.Count) < warmup || !r.Moved {
+		return
+	}
+	r.Mean, r.Std = r.Warm.MeanStdDev()
+	r.Ready = r.Std > 0
+}
+
+// fresh lists the points of data the chart has not seen yet.
+func (r *ControlReference) fresh(data []util.DataPoint) []util.DataPoint {
+	out := make([]util.DataPoint, 0, len(data))
+	for _, xx := range data {
+		if xx.Time > r.Last {
+			out = append(out, xx)
+			r.Last = xx.Time
+		}
+	}
+	return out
+}
+
+// CUSUMState is what the cumulative sum chart remembers about a series. High
+// and Low are the sums of standardized deviations above and below the
+// reference mean, less the slack.
+type CUSUMState struct {
+	ControlReference
+	High float64
+	Low  float64
+}
+
+// NewCUSUMState builds a state that has not started warming up.
+func NewCUSUMState() *CUSUMState {
+	return &CUSUMState{ControlReference: ControlReference{Last: math.MinInt64}}
+}
+
+// Update folds a new value into the sums.
+func (c *CUSUMState) Update(val float64, cfg config.CUSUMConfig) {
+	if !c.Ready {
+		c.Learn(val, cfg.Warmup)
+		return
+	}
+	z := (val - c.Mean) / c.Std
+	c.High = math.Max(0, c.High+z-cfg.K)
+	c.Low = math.Max(0, c.Low-z-cfg.K)
+}
+
+// CUSUM runs the cumulative sum chart on the points of a series it has not
+// seen yet, and fires cusum_high or cusum_low while the sums are past H.
+// Slow drifts that never leave a highway add up here until they do.
+func CUSUM(data []util.DataPoint, kvs map[string]string, record util.Recorder,
+	storage util.StorageEngine, cfg config.CUSUMConfig) {
+
+	state, ok := storage.ModelState(kvs, "cusum", func() interface{} {
+		return NewCUSUMState()
+	}).(*CUSUMState)
+	if !ok {
+		return
+	}
+	fresh := state.fresh(data)
+	for _, xx := range fresh {
+		state.Update(xx.Val, cfg)
+	}
+	if len(fresh) == 0 || !state.Ready {
+		return
+	}
+	curr := fresh[len(fresh)-1]
+	if state.High > cfg.H {
+		record.Record(util.Metric{Desc: anomaly.Labels(kvs, "cusum_high"), Data: util.DataPoint{Val: 1.0, Time: curr.Time}})
+	}
+	if state.Low > cfg.H {
+		record.Record(util.Metric{Desc: anomaly.Labels(kvs, "cusum_low"), Data: util.DataPoint{Val: 1.0, Time: curr.Time}})
+	}
+}
+
+// EWMAState is what the exponentially weighted moving average chart remembers
+// about a series.
+type EWMAState struct {
+	ControlReference
+	Average float64
+	Count   int
+}
+
+// NewEWMAState builds a state that has not started warming up.
+func NewEWMAState() *EWMAState {
+	return &EWMAState{ControlReference: ControlReference{Last: math.MinInt64}}
+}
+
+// Update folds a new value into the average, which starts at the reference mean.
+func (e *EWMAState) Update(val float64, cfg config.EWMAConfig) {
+	if !e.Ready {
+		e.Learn(val, cfg.Warmup)
+		e.Average = e.Mean
+		return
+	}
+	e.Average = cfg.Lambda*val + (1-cfg.Lambda)*e.Average
+	e.Count++
+}
+
+// Limits are the control limits around the reference mean after the points
+// seen so far; they widen towards their steady state as points come in.
+func (e *EWMAState) Limits(cfg config.EWMAConfig) HighwayVal {
+	spread := cfg.Lambda / (2 - cfg.Lambda) * (1 - math.Pow(1-cfg.Lambda, float64(2*e.Count)))
+	width := cfg.L * e.Std * math.Sqrt(spread)
+	return HighwayVal{High: e.Mean + width, Low: e.Mean - width}
+}
+
+// EWMA runs the moving average chart on the points of a series it has not
+// seen yet, and fires ewma while the average is outside its control limits.
+func EWMA(data []util.DataPoint, kvs map[string]string, record util.Recorder,
+	storage util.StorageEngine, cfg config.EWMAConfig) {
+
+	state, ok := storage.ModelState(kvs, "ewma", func() interface{} {
+		return NewEWMAState()
+	}).(*EWMAState)
+	if !ok {
+		return
+	}
+	fresh := state.fresh(data)
+	for _, xx := range fresh {
+		state.Update(xx.Val, cfg)
+	}
+	if len(fresh) == 0 || !state.Ready || state.Count == 0 {
+		return
+	}
+	curr := fresh[len(fresh)-1]
+	limits := state.Limits(cfg)
+	if state.Average > limits.High || state.Average < limits.Low {
+		record.Record(util.Metric{Desc: anomaly.Labels(kvs, "ewma"), Data: util.DataPoint{Val: 1.0, Time: curr.Time}})
+	}
+}
@@ -0,0 +1,72 @@
+package scoring
+
+import (
+	"math"
+	"testing"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/storage"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+func TestControlCharts(t *testing.T) {
+	store := storage.NewStore()
+	kvs := map[string]string{"__name__": "mem"}
+	cusum := config.DefaultCUSUM()
+	ewma := config.DefaultEWMA()
+	score := func(val float64, ts int64) map[string]bool {
+		store.Add(kvs, val, ts)
+		rec := util.NewRecorder()
+		CUSUM(store.Get(kvs), kvs, rec, store, cusum)
+		EWMA(store.Get(kvs), kvs, rec, store, ewma)
+		close(rec.Chan)
+		out := make(map[string]bool)
+		for x := range rec.Chan {
+			out[x.Desc["ft_model"]] = x.Desc["__name__"] == "anomaly" && x.Desc["ft_metric"] == "mem"
+		}
+		return out
+	}
+	noise := []float64{-2, 1, 0, 2, -1}
+
+	ts := int64(0)
+	for ; ts < 100; ts++ {
+		if got := score(100+noise[ts%5], ts); len(got) != 0 {
+			t.Fatal("a steady series should not fire", ts, got)
+		}
+	}
+	state := store.ModelState(kvs, "cusum", nil).(*CUSUMState)
+	if !state.Ready || math.Abs(state.Mean-100) > 1e-9 {
+		t.Error(state.ControlReference)
+	}
+
+	// a leak far too slow for a highway over the ring to notice
+	leak := 0.0
+	var fired map[string]bool
+	for ; ts < 200 && !(fired["cusum_high"] && fired["ewma"]); ts++ {
+		leak += 0.05
+		fired = score(100+leak+noise[ts%5], ts)
+	}
+	if !fired["cusum_high"] || !fired["ewma"] || fired["cusum_low"] {
+		t.Error("the leak was not caught", leak, fired)
+	}
+	if leak > 3 {
+		t.Error("the leak took too long to catch", leak)
+	}
+	if got := score(0, ts-1); len(got) != 0 {
+		t.Error("old points should not be charted twice", got)
+	}
+}
+
+func TestControlReference(t *testing.T) {
+	ref := ControlReference{}
+	for ii := 0; ii < 10; ii++ {
+		ref.Learn(5, 4)
+	}
+	if ref.Ready {
+		t.Error("a flat series has nothing to measure against", ref)
+	}
+	ref.Learn(6, 4)
+	if !ref.Ready || ref.Std <= 0 {
+		t.Error(ref)
+	}
+}
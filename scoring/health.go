@@ -0,0 +1,89 @@
+package scoring
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/open-fresh/data-sidecar/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// healthState is where the failures of the models on a series are kept.
+	healthState = "model_health"
+	// maxFailures is how many times in a row a model may fail on a series
+	// before it is disabled for that series.
+	maxFailures = 3
+	// disabledFor is how long a model that keeps failing is left alone.
+	disabledFor = 10 * time.Minute
+)
+
+var modelErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "sidecar_model_errors_total",
+	Help: "Number of model evaluations that panicked or failed, by model"},
+	[]string{"model"})
+
+func init() {
+	prometheus.MustRegister(modelErrors)
+}
+
+// modelHealth tracks how one model has been doing on one series.
+type modelHealth struct {
+	Failures int
+	Until    time.Time
+}
+
+// healthOf returns the health of every model on a series, or nil for a
+// series that is not stored.
+func healthOf(in *Input) map[string]*modelHealth {
+	health, _ := in.Storage.ModelState(in.Labels, healthState, func() interface{} {
+		return make(map[string]*modelHealth)
+	}).(map[string]*modelHealth)
+	return health
+}
+
+// evaluate runs a model on a series, turning a panic into an error.
+func evaluate(model Model, in *Input) (err error) {
+	ModelTimer(timerName(model.Name()), func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		err = model.Score(in)
+	})
+	return
+}
+
+// runModel runs a model on a series unless it has been failing there. Every
+// failure is counted and logged; after maxFailures in a row the model is
+// disabled for the series for a while, and a success resets the count.
+func runModel(model Model, in *Input) {
+	health := healthOf(in)
+	name := model.Name()
+	if health != nil && health[name] != nil && time.Now().Before(health[name].Until) {
+		return
+	}
+	err := evaluate(model, in)
+	if health == nil {
+		health = make(map[string]*modelHealth)
+	}
+	if err == nil {
+		delete(health, name)
+		return
+	}
+	modelErrors.WithLabelValues(name).Inc()
+	if health[name] == nil {
+		health[name] = &modelHealth{}
+	}
+	health[name].Failures++
+	if health[name].Failures < maxFailures {
+		log.Printf("model %s failed on %s: %v", name, util.MapSSToS(in.Labels), err)
+		return
+	}
+	health[name].Failures = 0
+	health[name].Until = time.Now().Add(disabledFor)
+	log.Printf("model %s failed on %s %d times in a row, disabling it there for %v: %v",
+		name, util.MapSSToS(in.Labels), maxFailures, disabledFor, err)
+}
@@ -0,0 +1,65 @@
+package scoring
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/storage"
+	"github.com/open-fresh/data-sidecar/util"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRunModel(t *testing.T) {
+	calls := 0
+	fail := true
+	model := ModelFuncs{"test_flaky", false, []string{"nothing"}, nil, nil, func(in *Input) error {
+		calls++
+		if !fail {
+			return nil
+		}
+		if calls%2 == 0 {
+			var short []float64
+			_ = short[3]
+		}
+		return errors.New("flaky")
+	}}
+	errorsSeen := func() float64 {
+		var m dto.Metric
+		modelErrors.WithLabelValues("test_flaky").(prometheus.Metric).Write(&m)
+		return m.GetCounter().GetValue()
+	}
+
+	store := storage.NewStore()
+	kvs := map[string]string{"__name__": "x"}
+	store.Add(kvs, 1, 1)
+	in := &Input{Labels: kvs, Models: config.DefaultModels(), Record: util.NewNullRecorder(), Storage: store}
+
+	for ii := 0; ii < maxFailures+2; ii++ {
+		runModel(model, in)
+	}
+	if calls != maxFailures || errorsSeen() != maxFailures {
+		t.Error("the model should be disabled after failing repeatedly", calls, errorsSeen())
+	}
+
+	// once the time is up the model gets another go
+	healthOf(in)["test_flaky"].Until = time.Now().Add(-time.Second)
+	fail = false
+	runModel(model, in)
+	runModel(model, in)
+	if calls != maxFailures+2 || healthOf(in)["test_flaky"] != nil {
+		t.Error(calls, healthOf(in))
+	}
+
+	// a series that is not stored has nowhere to keep count, but still runs
+	fail = true
+	gone := &Input{Labels: map[string]string{"__name__": "gone"}, Record: util.NewNullRecorder(), Storage: store}
+	for ii := 0; ii < maxFailures+2; ii++ {
+		runModel(model, gone)
+	}
+	if calls != 2*maxFailures+4 {
+		t.Error(calls)
+	}
+}
@@ -0,0 +1,45 @@
+package scoring
+
+import (
+	"fmt"
+	"strings"
+)
+
+// outputHelp describes each output a model records, for the HELP lines of
+// the exposition. Thresholds are named after the output and the metric they
+// are drawn for, as in high:node_load1.
+var outputHelp = map[string]string{
+	"anomaly":               "1 when the model in ft_model found the latest point of ft_metric anomalous",
+	"exit":                  "1 while ft_metric is outside a threshold of the model in ft_model",
+	"high":                  "Upper bound of the highway, the mean of the recent points plus sigma standard deviations",
+	"low":                   "Lower bound of the highway, the mean of the recent points minus sigma standard deviations",
+	"robust_high":           "Upper bound of the robust highway, the median of the recent points plus sigma scaled median absolute deviations",
+	"robust_low":            "Lower bound of the robust highway, the median of the recent points minus sigma scaled median absolute deviations",
+	"quantile_high":         "Upper bound of the quantile band, the high percentile of the recent points",
+	"quantile_low":          "Lower bound of the quantile band, the low percentile of the recent points",
+	"holt_winters_forecast": "Holt-Winters exponential smoothing forecast for the latest point",
+	"holt_winters_high":     "Upper bound of the Holt-Winters prediction interval",
+	"holt_winters_low":      "Lower bound of the Holt-Winters prediction interval",
+	"seasonal_high":         "Upper bound of the seasonal highway, drawn from the same time in previous periods",
+	"seasonal_low":          "Lower bound of the seasonal highway, drawn from the same time in previous periods",
+	"predicted_value":       "Value the linear trend predicts the series has ft_horizon seconds ahead",
+	"seconds_to_threshold":  "Seconds until the linear trend reaches the configured limit",
+	"changepoint_time":      "Time of the latest level shift the changepoint model found, in seconds",
+}
+
+// Help describes a family of recorded metrics, named without the export
+// prefix. Families no model records get a generic description.
+func Help(family string) string {
+	output, metric := family, ""
+	if idx := strings.Index(family, ":"); idx >= 0 {
+		output, metric = family[:idx], family[idx+1:]
+	}
+	help, ok := outputHelp[output]
+	switch {
+	case !ok:
+		return "Generated by the data sidecar"
+	case metric != "":
+		return fmt.Sprintf("%s, for %s", help, metric)
+	}
+	return help
+}
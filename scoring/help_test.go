@@ -0,0 +1,28 @@
+package scoring
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHelp(t *testing.T) {
+	for _, model := range Registered() {
+		if strings.HasPrefix(model.Name(), "test_") {
+			continue
+		}
+		for _, output := range model.Outputs() {
+			if _, ok := outputHelp[output]; !ok {
+				t.Error("no help for", model.Name(), output)
+			}
+		}
+	}
+	if g := Help("high:node_load1"); !strings.HasPrefix(g, "Upper bound of the highway") || !strings.HasSuffix(g, "for node_load1") {
+		t.Error(g)
+	}
+	if g := Help("exit"); g != outputHelp["exit"] {
+		t.Error(g)
+	}
+	if g := Help("something_else"); g != "Generated by the data sidecar" {
+		t.Error(g)
+	}
+}
@@ -1,6 +1,7 @@
 package scoring
 
 import (
+	"github.com/open-fresh/data-sidecar/config"
 	"github.com/open-fresh/data-sidecar/stat"
 	"github.com/open-fresh/data-sidecar/util"
 )
@@ -19,9 +20,9 @@ type HighwayExits struct {
 
 // Highway adds green highway data based on a histogram
 func Highway(curr util.DataPoint, data []util.DataPoint, kvs map[string]string,
-	record util.Recorder, storage util.StorageEngine) {
+	record util.Recorder, storage util.StorageEngine, cfg config.HighwayConfig) {
 
-	if len(data) < 20 {
+	if len(data) < cfg.MinPoints {
 		return
 	}
 
@@ -31,7 +32,7 @@ func Highway(curr util.DataPoint, data []util.DataPoint, kvs map[string]string,
 		tempSS.Insert(data[xx].Val)
 	}
 	mean, std := tempSS.MeanStdDev()
-	hwy := HighwayVal{High: mean + 3.*std, Low: mean - 3.*std}
+	hwy := HighwayVal{High: mean + cfg.Sigma*std, Low: mean - cfg.Sigma*std}
 	// replace the above calculation with whatever you like
 	// to generate upper and lower bounds
 	// anything will do, you can even break it out by series
@@ -47,14 +48,33 @@ func Highway(curr util.DataPoint, data []util.DataPoint, kvs map[string]string,
 
 // Record records all the relevant exits for a given highway
 func (e HighwayExits) Record(curr util.DataPoint, kvs map[string]string, record util.Recorder) {
-	RecordExit(e.High, curr.Time, kvs, "high", record)
-	RecordExit(e.Low, curr.Time, kvs, "low", record)
+	e.RecordNamed("", curr, kvs, record)
+}
+
+// RecordNamed records the exits of a highway drawn by the named model.
+func (e HighwayExits) RecordNamed(model string, curr util.DataPoint, kvs map[string]string, record util.Recorder) {
+	RecordExit(e.High, curr.Time, kvs, highwayName(model, "high"), record)
+	RecordExit(e.Low, curr.Time, kvs, highwayName(model, "low"), record)
 	outside := e.Low || e.High
-	RecordExit(outside, curr.Time, kvs, "outside", record)
+	RecordExit(outside, curr.Time, kvs, highwayName(model, "outside"), record)
 }
 
 // Record gets an entire map of quantile map and the rest and records them all
 func (h HighwayVal) Record(curr util.DataPoint, kvs map[string]string, record util.Recorder) {
-	RecordThreshold(util.DataPoint{Val: h.High, Time: curr.Time}, kvs, "high", record)
-	RecordThreshold(util.DataPoint{Val: h.Low, Time: curr.Time}, kvs, "low", record)
+	h.RecordNamed("", curr, kvs, record)
+}
+
+// RecordNamed records the bounds of a highway drawn by the named model.
+func (h HighwayVal) RecordNamed(model string, curr util.DataPoint, kvs map[string]string, record util.Recorder) {
+	RecordThreshold(util.DataPoint{Val: h.High, Time: curr.Time}, kvs, highwayName(model, "high"), record)
+	RecordThreshold(util.DataPoint{Val: h.Low, Time: curr.Time}, kvs, highwayName(model, "low"), record)
+}
+
+// highwayName keeps the plain highway's outputs named as they always were and
+// sets the others apart by model.
+func highwayName(model, bound string) string {
+	if model == "" {
+		return bound
+	}
+	return model + "_" + bound
 }
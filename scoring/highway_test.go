@@ -4,6 +4,7 @@ import (
 	"math"
 	"testing"
 
+	"github.com/open-fresh/data-sidecar/config"
 	"github.com/open-fresh/data-sidecar/storage"
 	"github.com/open-fresh/data-sidecar/util"
 )
@@ -22,7 +23,7 @@ func TestHighway(t *testing.T) {
 	tr := util.NewRecorder()
 	store := storage.NewStore()
 
-	Highway(currentValue, data, map[string]string{"a": "b", "__name__": "original"}, tr, store)
+	Highway(currentValue, data, map[string]string{"a": "b", "__name__": "original"}, tr, store, config.DefaultHighway())
 	close((*tr).Chan)
 	Process(t, (*tr).Chan)
 
@@ -37,12 +38,12 @@ func TestHighway(t *testing.T) {
 	names[3]["__name__"] = "cortex"
 	names[4]["__name__"] = "disk"
 	for ii := range names {
-		Highway(currentValue, data, names[ii], tr, store)
+		Highway(currentValue, data, names[ii], tr, store, config.DefaultHighway())
 	}
 	close((*tr).Chan)
 
 	tr = util.NewRecorder()
-	Highway(currentValue, data, map[string]string{"a": "b", "__name__": "original"}, tr, store)
+	Highway(currentValue, data, map[string]string{"a": "b", "__name__": "original"}, tr, store, config.DefaultHighway())
 	close((*tr).Chan)
 	Process(t, (*tr).Chan)
 }
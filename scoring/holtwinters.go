@@ -0,0 +1,95 @@
+package scoring
+
+import (
+	"math"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// HoltWintersState is what exponential smoothing remembers about a series
+// between scorings.
+type HoltWintersState struct {
+	Level    float64
+	Trend    float64
+	Seasons  []float64
+	Variance float64
+	Count    int
+	Last     int64
+}
+
+// NewHoltWintersState builds an empty state for a season of the given length.
+func NewHoltWintersState(season int) *HoltWintersState {
+	if season < 1 {
+		season = 1
+	}
+	return &HoltWintersState{Seasons: make([]float64, season), Last: math.MinInt64}
+}
+
+// Forecast is the prediction for the next point.
+func (h *HoltWintersState) Forecast() float64 {
+	return h.Level + h.Trend + h.Seasons[h.Count%len(h.Seasons)]
+}
+
+// Update folds a new value into the state.
+func (h *HoltWintersState) Update(val float64, cfg config.HoltWintersConfig) {
+	if h.Count == 0 {
+		h.Level = val
+		h.Count++
+		return
+	}
+	season := h.Count % len(h.Seasons)
+	err := val - h.Forecast()
+	h.Variance = cfg.Alpha*err*err + (1-cfg.Alpha)*h.Variance
+	level := cfg.Alpha*(val-h.Seasons[season]) + (1-cfg.Alpha)*(h.Level+h.Trend)
+	h.Trend = cfg.Beta*(level-h.Level) + (1-cfg.Beta)*h.Trend
+	if cfg.Season > 1 {
+		h.Seasons[season] = cfg.Gamma*(val-level) + (1-cfg.Gamma)*h.Seasons[season]
+	}
+	h.Level = level
+	h.Count++
+}
+
+// Bounds is the prediction interval around the next point.
+func (h *HoltWintersState) Bounds(sigma float64) HighwayVal {
+	forecast := h.Forecast()
+	width := sigma * math.Sqrt(h.Variance)
+	return HighwayVal{High: forecast + width, Low: forecast - width}
+}
+
+// HoltWinters keeps level, trend and seasonal smoothing state for a series in
+// the store and predicts its next point. Each point is checked against the
+// interval that was predicted for it before it is folded into the state.
+func HoltWinters(data []util.DataPoint, kvs map[string]string, record util.Recorder,
+	storage util.StorageEngine, cfg config.HoltWintersConfig) {
+
+	state, ok := storage.ModelState(kvs, "holt_winters", func() interface{} {
+		return NewHoltWintersState(cfg.Season)
+	}).(*HoltWintersState)
+	if !ok {
+		return
+	}
+	var curr util.DataPoint
+	var predicted HighwayVal
+	fresh := false
+	for _, xx := range data {
+		if xx.Time <= state.Last {
+			continue
+		}
+		predicted = state.Bounds(cfg.Sigma)
+		state.Update(xx.Val, cfg)
+		state.Last = xx.Time
+		curr = xx
+		fresh = true
+	}
+	if !fresh || state.Count < cfg.MinPoints {
+		return
+	}
+
+	exits := HighwayExits{High: curr.Val > predicted.High,
+		Low: curr.Val < predicted.Low}
+	exits.RecordNamed("holt_winters", curr, kvs, record)
+
+	RecordThreshold(util.DataPoint{Val: state.Forecast(), Time: curr.Time}, kvs, "holt_winters_forecast", record)
+	state.Bounds(cfg.Sigma).RecordNamed("holt_winters", curr, kvs, record)
+}
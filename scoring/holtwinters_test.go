@@ -0,0 +1,80 @@
+package scoring
+
+import (
+	"math"
+	"testing"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/storage"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+func TestHoltWintersState(t *testing.T) {
+	t.Run("trend", func(t *testing.T) {
+		cfg := config.DefaultHoltWinters()
+		h := NewHoltWintersState(cfg.Season)
+		for ii := 0; ii < 200; ii++ {
+			h.Update(float64(2*ii), cfg)
+		}
+		if f := h.Forecast(); math.Abs(f-400) > 0.5 {
+			t.Error(f)
+		}
+		if b := h.Bounds(3); b.High-b.Low > 1 {
+			t.Error("a clean line should have a narrow interval", b)
+		}
+	})
+	t.Run("season", func(t *testing.T) {
+		cfg := config.DefaultHoltWinters()
+		cfg.Season = 4
+		cfg.Gamma = 0.5
+		h := NewHoltWintersState(cfg.Season)
+		pattern := []float64{10, 20, 10, 0}
+		for ii := 0; ii < 400; ii++ {
+			h.Update(pattern[ii%4], cfg)
+		}
+		if f := h.Forecast(); math.Abs(f-pattern[0]) > 1 {
+			t.Error(f)
+		}
+	})
+}
+
+func TestHoltWinters(t *testing.T) {
+	store := storage.NewStore()
+	kvs := map[string]string{"__name__": "mem"}
+	cfg := config.DefaultHoltWinters()
+	score := func(val float64, ts int64) map[string]float64 {
+		store.Add(kvs, val, ts)
+		rec := util.NewRecorder()
+		HoltWinters(store.Get(kvs), kvs, rec, store, cfg)
+		close(rec.Chan)
+		out := make(map[string]float64)
+		for x := range rec.Chan {
+			out[x.Desc["__name__"]+x.Desc["ft_model"]] = x.Data.Val
+		}
+		return out
+	}
+
+	for ii := 1; ii < cfg.MinPoints; ii++ {
+		if got := score(100+float64(ii%3), int64(ii)); len(got) != 0 {
+			t.Error("should stay quiet while warming up", got)
+		}
+	}
+	// the ring only holds the last few points, the state remembers the rest
+	for ii := cfg.MinPoints; ii < 100; ii++ {
+		score(100+float64(ii%3), int64(ii))
+	}
+	got := score(101, 100)
+	if f := got["holt_winters_forecast:mem"]; f < 99 || f > 103 {
+		t.Error(got)
+	}
+	if got["holt_winters_high:mem"] <= got["holt_winters_low:mem"] || !math.IsNaN(got["exitholt_winters_outside"]) {
+		t.Error(got)
+	}
+	got = score(1000, 101)
+	if got["exitholt_winters_high"] != 1 || got["exitholt_winters_outside"] != 1 {
+		t.Error(got)
+	}
+	if got = score(0, 101); len(got) != 0 {
+		t.Error("old points should not be scored twice", got)
+	}
+}
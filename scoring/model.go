@@ -0,0 +1,204 @@
+package scoring
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/scoring/anomaly"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// Input is what a model gets to score a series with. History may be nil.
+type Input struct {
+	Curr    util.DataPoint
+	Data    []util.DataPoint
+	Labels  map[string]string
+	Models  config.Models
+	Record  util.Recorder
+	Storage util.StorageEngine
+	History util.HistoryEngine
+}
+
+// Model is one kind of analysis ScoreItem runs on a series.
+type Model interface {
+	// Name is what the model is timed by, unless timerNames says otherwise,
+	// and keeps its state under.
+	Name() string
+	// Enabled reports whether a series configured with these models runs it.
+	Enabled(config.Models) bool
+	// MinPoints is how many points of the series the model needs to run.
+	MinPoints(config.Models) int
+	// Stateful reports whether the model keeps state for each series in the store.
+	Stateful() bool
+	// Outputs names the metrics the model records.
+	Outputs() []string
+	// Score runs the model. A model may narrow in.Data for the models after it.
+	Score(in *Input) error
+}
+
+// ModelFuncs builds a Model out of functions.
+type ModelFuncs struct {
+	ModelName string
+	State     bool
+	Metrics   []string
+	IsEnabled func(config.Models) bool
+	Needs     func(config.Models) int
+	Run       func(*Input) error
+}
+
+// Name is the model name.
+func (m ModelFuncs) Name() string { return m.ModelName }
+
+// Enabled asks IsEnabled.
+func (m ModelFuncs) Enabled(models config.Models) bool { return m.IsEnabled(models) }
+
+// MinPoints asks Needs, and is 0 without it.
+func (m ModelFuncs) MinPoints(models config.Models) int {
+	if m.Needs == nil {
+		return 0
+	}
+	return m.Needs(models)
+}
+
+// Stateful is State.
+func (m ModelFuncs) Stateful() bool { return m.State }
+
+// Outputs is Metrics.
+func (m ModelFuncs) Outputs() []string { return m.Metrics }
+
+// Score calls Run.
+func (m ModelFuncs) Score(in *Input) error { return m.Run(in) }
+
+var (
+	registryLock sync.Mutex
+	registry     []Model
+)
+
+// Register adds a model to the ones ScoreItem runs, after those registered
+// before it. Names must be unique.
+func Register(model Model) error {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for _, xx := range registry {
+		if xx.Name() == model.Name() {
+			return fmt.Errorf("model %s is already registered", model.Name())
+		}
+	}
+	registry = append(registry, model)
+	return nil
+}
+
+// unregister removes a model from the registry.
+func unregister(name string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for ii, xx := range registry {
+		if xx.Name() == name {
+			registry = append(registry[:ii:ii], registry[ii+1:]...)
+			return
+		}
+	}
+}
+
+// timerNames keeps the names models were timed by in
+// sidecar_model_duration_summary before they were registered, so dashboards
+// built on them keep working.
+var timerNames = map[string]string{"holt_winters": "holtWinters", "nelson": "nelsonRules"}
+
+// timerName is what a model is timed by.
+func timerName(model string) string {
+	if name, ok := timerNames[model]; ok {
+		return name
+	}
+	return model
+}
+
+// Registered lists the registered models in the order they run.
+func Registered() []Model {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	return append([]Model(nil), registry...)
+}
+
+func init() {
+	// level shifts go first, since they narrow the data the others see
+	for _, model := range []Model{
+		ModelFuncs{"changepoint", true, []string{"anomaly", "changepoint_time"},
+			func(m config.Models) bool { return m.ChangePoint != nil }, nil,
+			func(in *Input) error {
+				in.Data = ChangePoint(in.Data, in.Labels, in.Record, in.Storage, *in.Models.ChangePoint)
+				return nil
+			}},
+		ModelFuncs{"highway", false, []string{"high", "low", "exit"},
+			func(m config.Models) bool { return m.Highway != nil },
+			func(m config.Models) int { return m.Highway.MinPoints },
+			func(in *Input) error {
+				Highway(in.Curr, in.Data, in.Labels, in.Record, in.Storage, *in.Models.Highway)
+				return nil
+			}},
+		ModelFuncs{"robust", false, []string{"robust_high", "robust_low", "exit"},
+			func(m config.Models) bool { return m.Robust != nil },
+			func(m config.Models) int { return m.Robust.MinPoints },
+			func(in *Input) error {
+				RobustHighway(in.Curr, in.Data, in.Labels, in.Record, *in.Models.Robust)
+				return nil
+			}},
+		ModelFuncs{"quantile", false, []string{"quantile_high", "quantile_low", "exit"},
+			func(m config.Models) bool { return m.Quantile != nil },
+			func(m config.Models) int { return m.Quantile.MinPoints },
+			func(in *Input) error {
+				QuantileBand(in.Curr, in.Data, in.Labels, in.Record, *in.Models.Quantile)
+				return nil
+			}},
+		ModelFuncs{"holt_winters", true, []string{"holt_winters_forecast", "holt_winters_high", "holt_winters_low", "exit"},
+			func(m config.Models) bool { return m.HoltWinters != nil }, nil,
+			func(in *Input) error {
+				HoltWinters(in.Data, in.Labels, in.Record, in.Storage, *in.Models.HoltWinters)
+				return nil
+			}},
+		ModelFuncs{"cusum", true, []string{"anomaly"},
+			func(m config.Models) bool { return m.CUSUM != nil }, nil,
+			func(in *Input) error {
+				CUSUM(in.Data, in.Labels, in.Record, in.Storage, *in.Models.CUSUM)
+				return nil
+			}},
+		ModelFuncs{"ewma", true, []string{"anomaly"},
+			func(m config.Models) bool { return m.EWMA != nil }, nil,
+			func(in *Input) error {
+				EWMA(in.Data, in.Labels, in.Record, in.Storage, *in.Models.EWMA)
+				return nil
+			}},
+		ModelFuncs{"seasonal", false, []string{"seasonal_high", "seasonal_low", "exit"},
+			func(m config.Models) bool { return m.Seasonal != nil }, nil,
+			func(in *Input) error {
+				return Seasonal(in.Curr, in.Labels, in.Record, in.History, *in.Models.Seasonal)
+			}},
+		ModelFuncs{"trend", false, []string{"predicted_value", "seconds_to_threshold"},
+			func(m config.Models) bool { return m.Trend != nil }, nil,
+			func(in *Input) error {
+				return Trend(in.Curr, in.Labels, in.Record, in.History, *in.Models.Trend)
+			}},
+		ModelFuncs{"nelson", false, []string{"anomaly"},
+			func(m config.Models) bool { return m.Nelson != nil },
+			func(m config.Models) int { return m.Nelson.MinPoints },
+			func(in *Input) error {
+				lookbackPoints := in.Models.Nelson.Window
+				if len(in.Data) < lookbackPoints {
+					lookbackPoints = len(in.Data)
+				}
+				vals := make([]float64, lookbackPoints, lookbackPoints)
+				for ii := range vals {
+					vals[ii] = in.Data[len(in.Data)-lookbackPoints+ii].Val
+				}
+				for _, x := range anomaly.NelsonRules(vals, in.Labels, in.Models.Nelson.Rules) {
+					in.Record.Record(util.Metric{Desc: x, Data: util.DataPoint{Val: 1.0, Time: in.Curr.Time}})
+				}
+				return nil
+			}},
+	} {
+		if err := Register(model); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package scoring
+
+import (
+	"testing"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/storage"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+func TestRegistry(t *testing.T) {
+	names := make(map[string]bool)
+	for _, model := range Registered() {
+		if names[model.Name()] || len(model.Outputs()) == 0 {
+			t.Error(model.Name())
+		}
+		names[model.Name()] = true
+	}
+	if Registered()[0].Name() != "changepoint" || !names["highway"] || !names["nelson"] {
+		t.Error(names)
+	}
+	if timerName("nelson") != "nelsonRules" || timerName("highway") != "highway" {
+		t.Error("models should keep the names they were timed by")
+	}
+	if err := Register(ModelFuncs{ModelName: "highway"}); err == nil {
+		t.Error("names should be unique")
+	}
+
+	// only run these for a highway nobody else uses
+	odd := func(m config.Models) bool { return m.Highway != nil && m.Highway.Sigma == 42 }
+	defer unregister("test_panic")
+	Register(ModelFuncs{"test_panic", false, []string{"nothing"}, odd, nil, func(in *Input) error {
+		panic("broken model")
+	}})
+	Register(ModelFuncs{"test_count", true, []string{"count"}, odd,
+		func(config.Models) int { return 3 },
+		func(in *Input) error {
+			state := in.Storage.ModelState(in.Labels, "test_count", func() interface{} { return new(int) }).(*int)
+			*state++
+			RecordThreshold(util.DataPoint{Val: float64(*state), Time: in.Curr.Time}, in.Labels, "count", in.Record)
+			return nil
+		}})
+
+	store := storage.NewStore()
+	kvs := map[string]string{"__name__": "x"}
+	highway := config.HighwayConfig{Sigma: 42, MinPoints: 100}
+	score := func(models config.Models) map[string]float64 {
+		rec := util.NewRecorder()
+		ScoreItem(kvs, models, rec, store, nil)
+		close(rec.Chan)
+		out := make(map[string]float64)
+		for x := range rec.Chan {
+			out[x.Desc["__name__"]] = x.Data.Val
+		}
+		return out
+	}
+	for ii := 0; ii < 5; ii++ {
+		store.Add(kvs, float64(ii), int64(ii))
+		score(config.DefaultModels())
+		got := score(config.Models{Highway: &highway})
+		if ii < 2 && len(got) != 0 {
+			t.Error("too few points to run", ii, got)
+		}
+		if ii >= 2 && got["count:x"] != float64(ii-1) {
+			t.Error("a panic in one model should not stop the next", ii, got)
+		}
+	}
+	unregister("test_count")
+	for _, model := range Registered() {
+		if model.Name() == "test_count" {
+			t.Error("test models should not outlive the test")
+		}
+	}
+}
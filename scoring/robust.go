@@ -0,0 +1,54 @@
+package scoring
+
+import (
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/stat"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// madScale turns a median absolute deviation into the standard deviation it
+// estimates for normal data, so sigma means the same thing as in Highway.
+const madScale = 1.4826
+
+// vals pulls the values out of a run of points.
+func vals(data []util.DataPoint) []float64 {
+	out := make([]float64, len(data))
+	for ii, xx := range data {
+		out[ii] = xx.Val
+	}
+	return out
+}
+
+// RobustHighway is Highway drawn around the median with the median absolute
+// deviation as its width, so one spike does not widen it enough to hide the next.
+func RobustHighway(curr util.DataPoint, data []util.DataPoint, kvs map[string]string,
+	record util.Recorder, cfg config.RobustConfig) {
+
+	if len(data) < cfg.MinPoints {
+		return
+	}
+	median, mad := stat.MedianAbsDev(vals(data))
+	width := cfg.Sigma * madScale * mad
+	hwy := HighwayVal{High: median + width, Low: median - width}
+	hwy.RecordNamed("robust", curr, kvs, record)
+
+	exits := HighwayExits{High: curr.Val > hwy.High,
+		Low: curr.Val < hwy.Low}
+	exits.RecordNamed("robust", curr, kvs, record)
+}
+
+// QuantileBand is a highway between two percentiles of the recent data.
+func QuantileBand(curr util.DataPoint, data []util.DataPoint, kvs map[string]string,
+	record util.Recorder, cfg config.QuantileConfig) {
+
+	if len(data) < cfg.MinPoints {
+		return
+	}
+	bounds := stat.Quantiles([]float64{cfg.Low, cfg.High}, vals(data))
+	hwy := HighwayVal{High: bounds[1], Low: bounds[0]}
+	hwy.RecordNamed("quantile", curr, kvs, record)
+
+	exits := HighwayExits{High: curr.Val > hwy.High,
+		Low: curr.Val < hwy.Low}
+	exits.RecordNamed("quantile", curr, kvs, record)
+}
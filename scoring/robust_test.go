@@ -0,0 +1,72 @@
+package scoring
+
+import (
+	"math"
+	"testing"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// bands runs one of the highways and collects what it recorded.
+func bands(run func(rec util.Recorder)) map[string]float64 {
+	rec := util.NewRecorder()
+	run(rec)
+	close(rec.Chan)
+	out := make(map[string]float64)
+	for x := range rec.Chan {
+		out[x.Desc["__name__"]+x.Desc["ft_model"]] = x.Data.Val
+	}
+	return out
+}
+
+func TestRobustHighway(t *testing.T) {
+	kvs := map[string]string{"__name__": "cpu"}
+	data := make([]util.DataPoint, 30)
+	for ii := range data {
+		data[ii].Val = 100 + float64(ii%5)
+	}
+	data[10].Val = 1e6
+	curr := util.DataPoint{Val: 1000}
+
+	got := bands(func(rec util.Recorder) {
+		RobustHighway(curr, data, kvs, rec, config.DefaultRobust())
+	})
+	if got["robust_high:cpu"] > 110 || got["robust_low:cpu"] < 90 {
+		t.Error("a spike should not widen the robust highway", got)
+	}
+	if got["exitrobust_high"] != 1 || got["exitrobust_outside"] != 1 {
+		t.Error(got)
+	}
+
+	// the mean and standard deviation highway is wide enough to let the point through
+	wide := bands(func(rec util.Recorder) {
+		Highway(curr, data, kvs, rec, nil, config.DefaultHighway())
+	})
+	if !math.IsNaN(wide["exithigh"]) {
+		t.Error(wide)
+	}
+
+	if got = bands(func(rec util.Recorder) {
+		RobustHighway(curr, data[:5], kvs, rec, config.DefaultRobust())
+	}); len(got) != 0 {
+		t.Error("too few points", got)
+	}
+}
+
+func TestQuantileBand(t *testing.T) {
+	kvs := map[string]string{"__name__": "cpu"}
+	data := make([]util.DataPoint, 101)
+	for ii := range data {
+		data[ii].Val = float64(ii)
+	}
+	got := bands(func(rec util.Recorder) {
+		QuantileBand(util.DataPoint{Val: 2}, data, kvs, rec, config.DefaultQuantile())
+	})
+	if got["quantile_high:cpu"] != 95 || got["quantile_low:cpu"] != 5 {
+		t.Error(got)
+	}
+	if got["exitquantile_low"] != 1 || !math.IsNaN(got["exitquantile_high"]) {
+		t.Error(got)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"reflect"
+	"sync"
 
-	"github.com/open-fresh/data-sidecar/scoring/anomaly"
+	"github.com/open-fresh/data-sidecar/config"
 	"github.com/open-fresh/data-sidecar/storage"
 	"github.com/open-fresh/data-sidecar/util"
 	"github.com/prometheus/client_golang/prometheus"
@@ -30,16 +32,61 @@ func init() {
 
 // Scorer holds the things the scorer needs for its work. A place to store data, a place to send it, and a way to learn about it.
 type Scorer struct {
+	*sync.Mutex
 	storage util.StorageEngine
 	record  util.Recorder
+	history util.HistoryEngine
+	models  map[string]config.Models
 }
 
 // NewScorer returns a pointer to a scorer.
 func NewScorer(store util.StorageEngine, record util.Recorder) *Scorer {
-	return &Scorer{store, record}
+	var mux sync.Mutex
+	return &Scorer{&mux, store, record, nil, make(map[string]config.Models)}
 
 }
 
+// SetHistory gives models that look further back than the store a place to look.
+func (s *Scorer) SetHistory(history util.HistoryEngine) {
+	s.Lock()
+	defer s.Unlock()
+	s.history = history
+}
+
+func (s *Scorer) getHistory() util.HistoryEngine {
+	s.Lock()
+	defer s.Unlock()
+	return s.history
+}
+
+// SetModels tells the scorer which models to run for the series of each selector.
+// Series of selectors that were dropped or whose models changed are forgotten so
+// they rebuild under the new settings; everything else keeps its state. It
+// returns the selectors that were reset.
+func (s *Scorer) SetModels(models map[string]config.Models) (reset []string) {
+	s.Lock()
+	defer s.Unlock()
+	for selector, old := range s.models {
+		if current, ok := models[selector]; !ok || !reflect.DeepEqual(old, current) {
+			reset = append(reset, selector)
+			s.storage.PruneLabel(util.SelectorLabel, selector)
+		}
+	}
+	s.models = models
+	return
+}
+
+// Models looks up the models to run on a series by the selector it came from.
+// Series from unknown selectors get the defaults.
+func (s *Scorer) Models(kvs map[string]string) config.Models {
+	s.Lock()
+	defer s.Unlock()
+	if models, ok := s.models[kvs[util.SelectorLabel]]; ok {
+		return models
+	}
+	return config.DefaultModels()
+}
+
 // Add is a passthrough
 func (s *Scorer) Add(kvs map[string]string, val float64, time int64) bool {
 	return s.storage.Add(kvs, val, time)
@@ -47,7 +94,7 @@ func (s *Scorer) Add(kvs map[string]string, val float64, time int64) bool {
 
 // Score tells the scorer that you're done adding points right now and to score the item.
 func (s *Scorer) Score(kvs map[string]string) {
-	ScoreItem(kvs, s.record, s.storage)
+	ScoreItem(kvs, s.Models(kvs), s.record, s.storage, s.getHistory())
 }
 
 type sortInfo struct {
@@ -77,32 +124,24 @@ func ModelTimer(name string, model func()) {
 	model()
 }
 
-// ScoreItem scores individual time series
-func ScoreItem(labels map[string]string, destination util.Recorder, store util.StorageEngine) {
+// ScoreItem scores individual time series with the registered models that are
+// enabled in models. History may be nil, in which case models that need it do
+// not run. A model that panics or fails is skipped without stopping the others.
+func ScoreItem(labels map[string]string, models config.Models, destination util.Recorder,
+	store util.StorageEngine, history util.HistoryEngine) {
 	data := store.Get(labels)
 
 	if (data == nil) || (len(data) <= 1) {
 		return
 	}
 
-	currentValue := data[len(data)-1]
-	ModelTimer("highway", func() {
-		Highway(currentValue, data, labels, destination, store)
-	})
-	lookbackPoints := 30
-	if len(data) <= lookbackPoints {
-		lookbackPoints = len(data) - 1
-	}
-	vals := make([]float64, lookbackPoints, lookbackPoints)
-	for ii := range vals {
-		vals[ii] = data[ii].Val
-	}
-	ModelTimer("nelsonRules", func() {
-		anoms := anomaly.Nelson(vals, labels)
-		for _, x := range anoms {
-			destination.Record(util.Metric{Desc: x, Data: util.DataPoint{Val: 1.0, Time: currentValue.Time}})
+	in := &Input{data[len(data)-1], data, labels, models, destination, store, history}
+	for _, model := range Registered() {
+		if !model.Enabled(models) || len(in.Data) < model.MinPoints(models) {
+			continue
 		}
-	})
+		runModel(model, in)
+	}
 }
 
 // ScoreOutput will help marshal scoring output.
@@ -112,6 +151,7 @@ type ScoreOutput struct {
 }
 
 // ScoreHandleFunc lets you query for all the names and all the things for each of them.
+// The data is scored with the models of the selector in info, if it has one.
 func (s *Scorer) ScoreHandleFunc(w http.ResponseWriter, r *http.Request) {
 	preData := (*r).FormValue("data")
 	preInfo := (*r).FormValue("info")
@@ -133,36 +173,41 @@ func (s *Scorer) ScoreHandleFunc(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	useOut := ScoreOverTime(data, info)
+	useOut := ScoreOverTime(data, info, s.Models(info))
 	output, _ := json.Marshal(useOut)
 	fmt.Fprint(w, string(output))
 	return
 }
 
-func (s *Scorer) ScoreData(data []util.DataPoint, kvs map[string]string, lastOnly bool) {
-	ScoreRange(data, kvs, s.record, s.storage, lastOnly)
+// ScoreData scores a range of points of a series, exporting only what the
+// models make of points from current on.
+func (s *Scorer) ScoreData(data []util.DataPoint, kvs map[string]string, current int64) {
+	ScoreRange(data, kvs, s.Models(kvs), s.record, s.storage, s.getHistory(), current)
 }
 
-// ScoreRange is the main scoring loop for ranges.
-func ScoreRange(data []util.DataPoint, kvs map[string]string, recorder util.Recorder, store util.StorageEngine, lastOnly bool) {
+// ScoreRange is the main scoring loop for ranges. Points the store already has
+// are skipped, so overlapping ranges are not scored twice. Points before
+// current are backfill: the models learn from them, but their outputs are
+// dropped rather than exported as if they were current. Models that only look
+// things up in history have nothing to learn, so they do not run on backfill.
+func ScoreRange(data []util.DataPoint, kvs map[string]string, models config.Models, recorder util.Recorder,
+	store util.StorageEngine, history util.HistoryEngine, current int64) {
 	null := util.NewNullRecorder()
-	for time := range data {
-		mydata := make([]util.DataPoint, time, time)
-		for ii := range mydata {
-			mydata[ii] = data[ii]
+	for _, point := range data {
+		if !store.Add(kvs, point.Val, point.Time) {
+			continue
 		}
-		store.Add(kvs, data[time].Val, data[time].Time)
-		if lastOnly && (time != len(data)-1) {
-			ScoreItem(kvs, null, store)
+		if point.Time < current {
+			ScoreItem(kvs, models, null, store, nil)
 		} else {
-			ScoreItem(kvs, recorder, store)
+			ScoreItem(kvs, models, recorder, store, history)
 		}
 	}
 	recorder.Finish()
 }
 
-// ScoreOverTime scores an individual series
-func ScoreOverTime(data []float64, kvs map[string]string) []ScoreOutput {
+// ScoreOverTime scores an individual series with models, from scratch.
+func ScoreOverTime(data []float64, kvs map[string]string, models config.Models) []ScoreOutput {
 	store := storage.NewStore()
 	output := make([]ScoreOutput, 0)
 	temp := make(map[string]ScoreOutput)
@@ -177,7 +222,7 @@ func ScoreOverTime(data []float64, kvs map[string]string) []ScoreOutput {
 		temp.Time = int64(ii)
 		mydata = append(mydata, temp)
 	}
-	go ScoreRange(mydata, kvs, recorder, store, false)
+	go ScoreRange(mydata, kvs, models, recorder, store, nil, math.MinInt64)
 	time := 0
 	for x := range recorder.Chan {
 		if math.IsNaN(x.Data.Val) {
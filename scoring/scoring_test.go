@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/open-fresh/data-sidecar/config"
 	"github.com/open-fresh/data-sidecar/storage"
 	"github.com/open-fresh/data-sidecar/util"
 )
@@ -55,7 +56,7 @@ func TestScore(t *testing.T) {
 		store.Add(map[string]string{"a": "b"}, 1., 1)
 		store.Add(map[string]string{"a": "b"}, 2., 2)
 		store.Add(map[string]string{"a": "b"}, 3., 3)
-		ScoreItem(map[string]string{"a": "b"}, rec, store)
+		ScoreItem(map[string]string{"a": "b"}, config.DefaultModels(), rec, store, nil)
 
 		close(rec.Chan)
 		somethingCameBack := false
@@ -76,7 +77,7 @@ func TestScore(t *testing.T) {
 		store.Add(map[string]string{"a": "b"}, 6., 6)
 		store.Add(map[string]string{"a": "b"}, 7., 7)
 		store.Add(map[string]string{"a": "b"}, 8., 8)
-		ScoreItem(map[string]string{"a": "b"}, rec, store)
+		ScoreItem(map[string]string{"a": "b"}, config.DefaultModels(), rec, store, nil)
 		close(rec.Chan)
 		somethingCameBack = false
 		for _ = range rec.Chan {
@@ -88,6 +89,43 @@ func TestScore(t *testing.T) {
 	})
 }
 
+func TestScoreRange(t *testing.T) {
+	labels := map[string]string{"a": "b"}
+	data := make([]util.DataPoint, 60)
+	for ii := range data {
+		data[ii] = util.DataPoint{Val: withJitter(float64(ii % 7)), Time: int64(ii)}
+	}
+	scored := func(data []util.DataPoint, store *storage.Store, current int64) map[int64]bool {
+		rec := util.NewRecorder()
+		ScoreRange(data, labels, config.DefaultModels(), rec, store, nil, current)
+		out := make(map[int64]bool)
+		for g := range rec.Chan {
+			out[g.Data.Time] = true
+		}
+		return out
+	}
+
+	store := storage.NewStore()
+	times := scored(data[:40], store, 30)
+	if len(times) == 0 {
+		t.Error("current points should be exported")
+	}
+	for tt := range times {
+		if tt < 30 {
+			t.Error("backfill was exported as current:", tt)
+		}
+	}
+	times = scored(data[20:], store, 50)
+	for tt := range times {
+		if tt < 50 {
+			t.Error("overlapping points were scored again:", tt)
+		}
+	}
+	if len(store.Get(labels)) == 0 || store.Get(labels)[len(store.Get(labels))-1].Time != 59 {
+		t.Error("backfill should still reach the store")
+	}
+}
+
 func TestHandlers(t *testing.T) {
 	x := storage.NewStore()
 	rec := util.NewRecorder()
@@ -120,8 +158,42 @@ func TestHandlers(t *testing.T) {
 		rw = util.NewHTTPResponseWriter()
 		r = &http.Request{Form: url.Values{"data": []string{"[1,2,3,4,5,1,2,3,4,5,1,2,3,4,5,1,2,3,4,5,1,2,3,4,5,1,2,3,4,5,1,2,3,4,5,1,2,3,4,5,1,2,3,4,5]"}, "info": []string{`{"__name__":"hello"}`}}}
 		sc.ScoreHandleFunc(rw, r)
-		if g := rw.String(); !strings.Contains(g, "Data") || !strings.Contains(g, "hello") {
+		if g := rw.String(); !strings.Contains(g, "Data") || !strings.Contains(g, "high:hello") {
 			t.Error(g)
 		}
+		nelson := config.DefaultNelson()
+		sc.SetModels(map[string]config.Models{"only": {Nelson: &nelson}})
+		rw = util.NewHTTPResponseWriter()
+		r = &http.Request{Form: url.Values{"data": r.Form["data"], "info": []string{`{"__name__":"hello","ft_selector":"only"}`}}}
+		sc.ScoreHandleFunc(rw, r)
+		if g := rw.String(); strings.Contains(g, "high:hello") {
+			t.Error("the models of the selector in info should score", g)
+		}
 	})
 }
+
+func TestSetModels(t *testing.T) {
+	store := storage.NewStore()
+	sc := NewScorer(store, util.NewNullRecorder())
+	kept := map[string]string{util.SelectorLabel: "kept"}
+	changed := map[string]string{util.SelectorLabel: "changed"}
+	if g := sc.Models(kept); g.Highway == nil || g.Nelson == nil {
+		t.Error("unknown selectors get the defaults", g)
+	}
+	sc.SetModels(map[string]config.Models{"kept": config.DefaultModels(), "changed": config.DefaultModels()})
+	sc.Add(kept, 1, 1)
+	sc.Add(changed, 1, 1)
+
+	tighter := config.DefaultModels()
+	tighter.Highway.Sigma = 2
+	reset := sc.SetModels(map[string]config.Models{"kept": config.DefaultModels(), "changed": tighter})
+	if len(reset) != 1 || reset[0] != "changed" {
+		t.Error(reset)
+	}
+	if len(store.Get(kept)) != 1 || len(store.Get(changed)) != 0 {
+		t.Error("only series with new settings should be reset")
+	}
+	if g := sc.Models(changed); g.Highway.Sigma != 2 {
+		t.Error(g)
+	}
+}
@@ -0,0 +1,48 @@
+package scoring
+
+import (
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/stat"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// Seasonal draws a highway from what the series did around the same time in
+// previous periods, so daily or weekly cycles are not mistaken for anomalies.
+// It fails only when none of the periods could be looked up.
+func Seasonal(curr util.DataPoint, kvs map[string]string, record util.Recorder,
+	history util.HistoryEngine, cfg config.SeasonalConfig) error {
+
+	if history == nil {
+		return nil
+	}
+	vals := make([]float64, 0)
+	var lastErr error
+	failed := 0
+	for ii := 1; ii <= cfg.Periods; ii++ {
+		then := curr.Time - int64(ii*cfg.Period)
+		past, err := history.History(kvs, then-int64(cfg.Window), then+int64(cfg.Window))
+		if err != nil {
+			lastErr = err
+			failed++
+			continue
+		}
+		for _, xx := range past {
+			vals = append(vals, xx.Val)
+		}
+	}
+	if failed == cfg.Periods {
+		return lastErr
+	}
+	if len(vals) < cfg.MinPoints {
+		return nil
+	}
+
+	mean, std := stat.MeanStdDev(vals)
+	hwy := HighwayVal{High: mean + cfg.Sigma*std, Low: mean - cfg.Sigma*std}
+	hwy.RecordNamed("seasonal", curr, kvs, record)
+
+	exits := HighwayExits{High: curr.Val > hwy.High,
+		Low: curr.Val < hwy.Low}
+	exits.RecordNamed("seasonal", curr, kvs, record)
+	return nil
+}
@@ -0,0 +1,84 @@
+package scoring
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// dailyHistory pretends a series always sat at 100 at noon and 0 otherwise.
+type dailyHistory struct {
+	calls int
+	fail  bool
+}
+
+func (d *dailyHistory) History(labels map[string]string, start, end int64) ([]util.DataPoint, error) {
+	d.calls++
+	if d.fail {
+		return nil, errors.New("unreachable")
+	}
+	out := make([]util.DataPoint, 0)
+	for ts := start; ts <= end; ts += 10 {
+		val := 0.
+		if ts%86400 >= 43200-600 && ts%86400 <= 43200+600 {
+			val = 100 + float64(ts%7)
+		}
+		out = append(out, util.DataPoint{Val: val, Time: ts})
+	}
+	return out, nil
+}
+
+func (d *dailyHistory) Evaluate(query string, at int64) ([]util.Series, error) {
+	return nil, errors.New("not an expression engine")
+}
+
+func TestSeasonal(t *testing.T) {
+	kvs := map[string]string{"__name__": "requests"}
+	noon := util.DataPoint{Val: 103, Time: 10*86400 + 43200}
+	collect := func(history util.HistoryEngine, curr util.DataPoint, cfg config.SeasonalConfig) map[string]float64 {
+		rec := util.NewRecorder()
+		Seasonal(curr, kvs, rec, history, cfg)
+		close(rec.Chan)
+		out := make(map[string]float64)
+		for x := range rec.Chan {
+			out[x.Desc["__name__"]+x.Desc["ft_model"]] = x.Data.Val
+		}
+		return out
+	}
+
+	t.Run("busy at noon is normal", func(t *testing.T) {
+		history := &dailyHistory{}
+		got := collect(history, noon, config.DefaultSeasonal())
+		if history.calls != 4 {
+			t.Error(history.calls)
+		}
+		if got["seasonal_high:requests"] < 103 || got["seasonal_low:requests"] > 103 {
+			t.Error(got)
+		}
+		if !math.IsNaN(got["exitseasonal_outside"]) {
+			t.Error(got)
+		}
+	})
+	t.Run("busy at midnight is not", func(t *testing.T) {
+		got := collect(&dailyHistory{}, util.DataPoint{Val: 103, Time: 10 * 86400}, config.DefaultSeasonal())
+		if got["exitseasonal_high"] != 1 || got["exitseasonal_outside"] != 1 {
+			t.Error(got)
+		}
+	})
+	t.Run("not enough history", func(t *testing.T) {
+		cfg := config.DefaultSeasonal()
+		cfg.MinPoints = 1000
+		if got := collect(&dailyHistory{}, noon, cfg); len(got) != 0 {
+			t.Error(got)
+		}
+		if got := collect(&dailyHistory{fail: true}, noon, config.DefaultSeasonal()); len(got) != 0 {
+			t.Error(got)
+		}
+		if got := collect(nil, noon, config.DefaultSeasonal()); len(got) != 0 {
+			t.Error(got)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package scoring
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/stat"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// trendPoints caps how many points of history a trend is fitted to, since
+// the fit compares every pair of them.
+const trendPoints = 120
+
+// HorizonLabel tells the forecasts of one series for different horizons apart.
+const HorizonLabel = "ft_horizon"
+
+// limitFor picks the series of a limit expression that belongs with the
+// series labels describe: the first one that agrees with it on every label
+// they both have.
+func limitFor(limits []util.Series, labels map[string]string) (util.DataPoint, bool) {
+	for _, xx := range limits {
+		if len(xx.Data) == 0 {
+			continue
+		}
+		agrees := true
+		for key, val := range xx.Labels {
+			if key == "__name__" || key == util.SelectorLabel {
+				continue
+			}
+			if have, ok := labels[key]; ok && have != val {
+				agrees = false
+				break
+			}
+		}
+		if agrees {
+			return xx.Data[len(xx.Data)-1], true
+		}
+	}
+	return util.DataPoint{}, false
+}
+
+// Trend fits a robust line to the history of a series and extends it, to
+// tell when a capacity metric such as disk usage will run out. It records the
+// value predicted at each horizon and, given a limit, how many seconds are
+// left until the trend reaches it. A trend that went through the limit within
+// the lookback has 0 seconds left; one that is flat or has stayed on the same
+// side of the limit, moving away from it, has +Inf.
+func Trend(curr util.DataPoint, kvs map[string]string, record util.Recorder,
+	history util.HistoryEngine, cfg config.TrendConfig) error {
+
+	if history == nil {
+		return nil
+	}
+	past, err := history.History(kvs, curr.Time-int64(cfg.Lookback), curr.Time)
+	if err != nil {
+		return err
+	}
+	if len(past) < cfg.MinPoints {
+		return nil
+	}
+	stride := (len(past) + trendPoints - 1) / trendPoints
+	x := make([]float64, 0, trendPoints)
+	y := make([]float64, 0, trendPoints)
+	// step back from the newest point, so it is always part of the fit
+	for ii := len(past) - 1; ii >= 0; ii -= stride {
+		x = append(x, float64(past[ii].Time-curr.Time))
+		y = append(y, past[ii].Val)
+	}
+	// with times taken from now, the intercept is where the trend is now
+	slope, now := stat.TheilSen(x, y)
+	if math.IsNaN(slope) {
+		return nil
+	}
+
+	for _, horizon := range cfg.Horizons {
+		labels := make(map[string]string, len(kvs)+1)
+		for key, val := range kvs {
+			labels[key] = val
+		}
+		labels[HorizonLabel] = strconv.Itoa(horizon)
+		RecordThreshold(util.DataPoint{Val: now + slope*float64(horizon), Time: curr.Time}, labels, "predicted_value", record)
+	}
+
+	if cfg.Limit == "" {
+		return nil
+	}
+	limits, err := history.Evaluate(cfg.Limit, curr.Time)
+	if err != nil {
+		return err
+	}
+	limit, ok := limitFor(limits, kvs)
+	if !ok {
+		return nil
+	}
+	left := (limit.Val - now) / slope
+	switch {
+	case left < 0 && left >= float64(past[0].Time-curr.Time):
+		// the trend went through the limit within the lookback and goes on
+		// past it, so there is no time left
+		left = 0
+	case !(left >= 0) || math.IsInf(left, 0):
+		left = math.Inf(1)
+	}
+	RecordThreshold(util.DataPoint{Val: left, Time: curr.Time}, kvs, "seconds_to_threshold", record)
+	return nil
+}
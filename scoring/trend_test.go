@@ -0,0 +1,109 @@
+package scoring
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/storage"
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+// fillingDisk pretends a disk fills up by a byte a second, with the odd hiccup,
+// and has a size of 10000 bytes. A disk that stopped filling stays at 5000,
+// and one that is draining loses half a byte a second from 9000.
+type fillingDisk struct {
+	noLimit  bool
+	stopped  bool
+	draining bool
+	asked    int
+}
+
+func (f *fillingDisk) History(labels map[string]string, start, end int64) ([]util.DataPoint, error) {
+	f.asked++
+	out := make([]util.DataPoint, 0)
+	for ts := start - start%10; ts <= end; ts += 10 {
+		val := float64(ts % 100000)
+		if ts%700 == 0 {
+			val = 0
+		}
+		if f.stopped {
+			val = 5000
+		}
+		if f.draining {
+			val = 9000 - float64(ts)/2
+		}
+		out = append(out, util.DataPoint{Val: val, Time: ts})
+	}
+	return out, nil
+}
+
+func (f *fillingDisk) Evaluate(query string, at int64) ([]util.Series, error) {
+	if f.noLimit {
+		return nil, errors.New("no limit")
+	}
+	return []util.Series{
+		{Labels: map[string]string{"__name__": "size", "device": "sdb"}, Data: []util.DataPoint{{Val: 1, Time: at}}},
+		{Labels: map[string]string{"__name__": "size", "device": "sda"}, Data: []util.DataPoint{{Val: 10000, Time: at}}},
+	}, nil
+}
+
+func TestTrend(t *testing.T) {
+	kvs := map[string]string{"__name__": "usage", "device": "sda"}
+	collect := func(history util.HistoryEngine, curr util.DataPoint, cfg config.TrendConfig) map[string]float64 {
+		rec := util.NewRecorder()
+		Trend(curr, kvs, rec, history, cfg)
+		close(rec.Chan)
+		out := make(map[string]float64)
+		for x := range rec.Chan {
+			out[x.Desc["__name__"]+x.Desc[HorizonLabel]] = x.Data.Val
+		}
+		return out
+	}
+	cfg := config.DefaultTrend()
+	cfg.Lookback = 3600
+	cfg.Limit = "size"
+	now := util.DataPoint{Val: 4000, Time: 4000}
+
+	got := collect(&fillingDisk{}, now, cfg)
+	if math.Abs(got["predicted_value:usage3600"]-7600) > 1 || math.Abs(got["predicted_value:usage86400"]-90400) > 1 {
+		t.Error(got)
+	}
+	if math.Abs(got["seconds_to_threshold:usage"]-6000) > 1 {
+		t.Error(got)
+	}
+
+	if got = collect(&fillingDisk{noLimit: true}, now, cfg); len(got) != 2 {
+		t.Error("forecasts do not need a limit", got)
+	}
+	if got = collect(&fillingDisk{stopped: true}, now, cfg); !math.IsInf(got["seconds_to_threshold:usage"], 1) {
+		t.Error(got)
+	}
+	if got = collect(&fillingDisk{draining: true}, now, cfg); !math.IsInf(got["seconds_to_threshold:usage"], 1) {
+		t.Error("a trend moving away from the limit never reaches it", got)
+	}
+	if got = collect(&fillingDisk{}, util.DataPoint{Val: 11000, Time: 11000}, cfg); got["seconds_to_threshold:usage"] != 0 {
+		t.Error("a trend that went past the limit has no time left", got)
+	}
+	if got = collect(nil, now, cfg); len(got) != 0 {
+		t.Error(got)
+	}
+
+	models := config.DefaultModels()
+	models.Trend = &cfg
+	disk := &fillingDisk{}
+	data := make([]util.DataPoint, 40)
+	for ii := range data {
+		data[ii] = util.DataPoint{Val: float64(ii), Time: int64(4000 + 10*ii)}
+	}
+	rec := util.NewRecorder()
+	go func() {
+		for range rec.Chan {
+		}
+	}()
+	ScoreRange(data, kvs, models, rec, storage.NewStore(), disk, 4000+10*35)
+	if disk.asked != 5 {
+		t.Error("only current points should look up history", disk.asked)
+	}
+}
@@ -4,6 +4,7 @@ package stat
 
 import (
 	"math"
+	"sort"
 	"time"
 )
 
@@ -92,16 +93,79 @@ func MeanStdDev(x []float64) (mean, std float64) {
 	return
 }
 
-// Quantile computes the quantile
+// Quantile computes the p quantile of x, interpolating linearly between the
+// closest order statistics. x does not need to be sorted and is left alone.
+// An empty x has no quantiles and gives NaN.
 func Quantile(p float64, x []float64) (quantile float64) {
-	var cumsum float64
-	sumWeights := float64(len(x))
-	fidx := p * sumWeights
-	for i := range x {
-		cumsum++
-		if cumsum >= fidx {
-			return x[i]
+	return Quantiles([]float64{p}, x)[0]
+}
+
+// Quantiles computes several quantiles of x with a single sort.
+func Quantiles(ps []float64, x []float64) []float64 {
+	out := make([]float64, len(ps))
+	if len(x) == 0 {
+		for ii := range out {
+			out[ii] = math.NaN()
 		}
+		return out
+	}
+	sorted := make([]float64, len(x))
+	copy(sorted, x)
+	sort.Float64s(sorted)
+	for ii, p := range ps {
+		out[ii] = sortedQuantile(p, sorted)
+	}
+	return out
+}
+
+// sortedQuantile is Quantile for data that is already sorted.
+func sortedQuantile(p float64, sorted []float64) float64 {
+	if p <= 0 {
+		return sorted[0]
+	}
+	if p >= 1 {
+		return sorted[len(sorted)-1]
+	}
+	pos := p * float64(len(sorted)-1)
+	lower := math.Floor(pos)
+	frac := pos - lower
+	if frac == 0 {
+		return sorted[int(lower)]
+	}
+	return sorted[int(lower)] + frac*(sorted[int(lower)+1]-sorted[int(lower)])
+}
+
+// MedianAbsDev calculates the median and the median absolute deviation from it.
+func MedianAbsDev(x []float64) (median, mad float64) {
+	median = Quantile(0.5, x)
+	dev := make([]float64, len(x))
+	for ii, xx := range x {
+		dev[ii] = math.Abs(xx - median)
+	}
+	mad = Quantile(0.5, dev)
+	return
+}
+
+// TheilSen fits a line to the points (x, y) as the median of the slopes
+// between every pair of points, so outliers barely move it. The intercept is
+// the median of what is left of y once the slope is taken out. Without two
+// distinct x there is no line and both are NaN.
+func TheilSen(x, y []float64) (slope, intercept float64) {
+	slopes := make([]float64, 0, len(x)*(len(x)-1)/2)
+	for ii := range x {
+		for jj := ii + 1; jj < len(x); jj++ {
+			if x[jj] != x[ii] {
+				slopes = append(slopes, (y[jj]-y[ii])/(x[jj]-x[ii]))
+			}
+		}
+	}
+	if len(slopes) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	slope = Quantile(0.5, slopes)
+	rest := make([]float64, len(x))
+	for ii := range x {
+		rest[ii] = y[ii] - slope*x[ii]
 	}
-	return x[len(x)-1]
+	return slope, Quantile(0.5, rest)
 }
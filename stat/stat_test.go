@@ -1,6 +1,7 @@
 package stat
 
 import (
+	"math"
 	"testing"
 )
 
@@ -47,3 +48,52 @@ func TestMeanStdDevSkew(t *testing.T) {
 	}
 
 }
+
+func TestQuantiles(t *testing.T) {
+	x := []float64{5, 1, 4, 2, 3}
+	cases := map[float64]float64{0: 1, 0.25: 2, 0.5: 3, 0.6: 3.4, 0.9: 4.6, 1: 5, -1: 1, 2: 5}
+	for p, want := range cases {
+		if got := Quantile(p, x); math.Abs(got-want) > 1e-9 {
+			t.Error(p, got, want)
+		}
+	}
+	if x[0] != 5 || x[1] != 1 {
+		t.Error("input should not be sorted in place", x)
+	}
+	if got := Quantiles([]float64{0.5, 0.5}, []float64{1, 2}); got[0] != 1.5 || got[1] != 1.5 {
+		t.Error(got)
+	}
+	if got := Quantile(0.5, []float64{7}); got != 7 {
+		t.Error(got)
+	}
+	if got := Quantile(0.5, nil); !math.IsNaN(got) {
+		t.Error(got)
+	}
+}
+
+func TestMedianAbsDev(t *testing.T) {
+	if m, mad := MedianAbsDev([]float64{1, 1, 2, 2, 4, 6, 9}); m != 2 || mad != 1 {
+		t.Error(m, mad)
+	}
+	// one spike moves the standard deviation a lot and the mad not at all
+	if m, mad := MedianAbsDev([]float64{1, 1, 2, 2, 4, 6, 9000}); m != 2 || mad != 1 {
+		t.Error(m, mad)
+	}
+}
+
+func TestTheilSen(t *testing.T) {
+	x := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	y := make([]float64, len(x))
+	for ii := range x {
+		y[ii] = 3 + 2*x[ii]
+	}
+	// a couple of wild points do not bend the line
+	y[2] = 1000
+	y[7] = -1000
+	if slope, intercept := TheilSen(x, y); slope != 2 || intercept != 3 {
+		t.Error(slope, intercept)
+	}
+	if slope, intercept := TheilSen([]float64{1, 1}, []float64{2, 3}); !math.IsNaN(slope) || !math.IsNaN(intercept) {
+		t.Error("no line through a single x", slope, intercept)
+	}
+}
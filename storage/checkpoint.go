@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/open-fresh/data-sidecar/util"
+)
+
+const (
+	// snapshotVersion changes whenever the layout of storeDetails does.
+	snapshotVersion = 2
+	snapshotFile    = "ringstore.json"
+)
+
+var (
+	errSnapshotVersion = errors.New("snapshot version mismatch")
+	errSnapshotStale   = errors.New("snapshot too old")
+)
+
+// snapshot is what a checkpoint writes to disk.
+type snapshot struct {
+	Version int
+	Time    int64
+	Data    map[string]storeDetails
+}
+
+// Checkpoint writes the store into dir. The snapshot goes to a temporary file
+// first and is renamed into place, so a crash never leaves half a snapshot.
+func (s *Store) Checkpoint(dir string) error {
+	s.Lock()
+	out, err := json.Marshal(snapshot{snapshotVersion, time.Now().Unix(), s.Data})
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+snapshotFile)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(out); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, snapshotFile))
+}
+
+// Restore loads the snapshot in dir into the store unless it is older than
+// maxAge. Series that do not fit the store are skipped; the number restored
+// is returned.
+func (s *Store) Restore(dir string, maxAge time.Duration) (int, error) {
+	in, err := ioutil.ReadFile(filepath.Join(dir, snapshotFile))
+	if err != nil {
+		return 0, err
+	}
+	var snap snapshot
+	if err = json.Unmarshal(in, &snap); err != nil {
+		return 0, fmt.Errorf("corrupt snapshot: %v", err)
+	}
+	if snap.Version != snapshotVersion {
+		return 0, fmt.Errorf("%v: found %d, want %d", errSnapshotVersion, snap.Version, snapshotVersion)
+	}
+	if age := time.Since(time.Unix(snap.Time, 0)); age > maxAge {
+		return 0, fmt.Errorf("%v: written %v ago", errSnapshotStale, age)
+	}
+	restored := 0
+	s.Lock()
+	defer s.Unlock()
+	for key, val := range snap.Data {
+		if len(val.Data) < 2 || val.Index < 0 || val.Index >= len(val.Data) || key != util.MapSSToS(val.Meta) {
+			continue
+		}
+		s.Data[key] = val
+		if length := s.length(val.Meta); length != len(val.Data) {
+			s.Data[key] = s.resize(key, length)
+		}
+		restored++
+	}
+	return restored, nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	x := NewStore()
+	for ii := 0; ii < 30; ii++ {
+		x.Add(map[string]string{"1": "1"}, float64(ii), int64(ii)+1)
+	}
+	x.Add(map[string]string{"1": "2"}, 1.0, 5)
+
+	t.Run("nothing to restore", func(t *testing.T) {
+		if _, err := NewStore().Restore(dir, time.Hour); err == nil {
+			t.Error("expected an error without a snapshot")
+		}
+	})
+	t.Run("round trip", func(t *testing.T) {
+		if err := x.Checkpoint(dir); err != nil {
+			t.Fatal(err)
+		}
+		files, _ := ioutil.ReadDir(dir)
+		if len(files) != 1 {
+			t.Error("temporary files left behind", files)
+		}
+		y := NewStore()
+		n, err := y.Restore(dir, time.Hour)
+		if err != nil || n != 2 {
+			t.Fatal(n, err)
+		}
+		for _, kvs := range []map[string]string{{"1": "1"}, {"1": "2"}} {
+			vx, vy := x.Get(kvs), y.Get(kvs)
+			if len(vx) != len(vy) || vx[len(vx)-1] != vy[len(vy)-1] {
+				t.Error(vx, vy)
+			}
+		}
+		if y.Add(map[string]string{"1": "1"}, 1.0, 30) {
+			t.Error("restored series should remember their last timestamp")
+		}
+	})
+	t.Run("stale", func(t *testing.T) {
+		if _, err := NewStore().Restore(dir, -time.Second); err == nil || !strings.Contains(err.Error(), "too old") {
+			t.Error(err)
+		}
+	})
+	t.Run("version mismatch", func(t *testing.T) {
+		ioutil.WriteFile(filepath.Join(dir, snapshotFile), []byte(`{"Version":0,"Time":0}`), 0644)
+		if _, err := NewStore().Restore(dir, time.Hour); err == nil || !strings.Contains(err.Error(), "version") {
+			t.Error(err)
+		}
+	})
+	t.Run("corrupt", func(t *testing.T) {
+		ioutil.WriteFile(filepath.Join(dir, snapshotFile), []byte(`{"Version":2,`), 0644)
+		if _, err := NewStore().Restore(dir, time.Hour); err == nil || !strings.Contains(err.Error(), "corrupt") {
+			t.Error(err)
+		}
+	})
+	t.Run("bad series are skipped", func(t *testing.T) {
+		ioutil.WriteFile(filepath.Join(dir, snapshotFile), []byte(fmt.Sprintf(`{"Version":2,"Time":%d,"Data":{
+			"{\"1\":\"1\"}":{"Index":99,"Meta":{"1":"1"}},
+			"wrong":{"Index":1,"Meta":{"1":"2"}}}}`, time.Now().Unix())), 0644)
+		if n, err := NewStore().Restore(dir, time.Hour); err != nil || n != 0 {
+			t.Error(n, err)
+		}
+	})
+	t.Run("unwritable", func(t *testing.T) {
+		if err := x.Checkpoint(filepath.Join(dir, "missing")); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
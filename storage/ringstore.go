@@ -12,10 +12,14 @@ import (
 )
 
 const (
-	max = 22
+	// DefaultLength is how many points a series keeps unless told otherwise.
+	DefaultLength = 30
 )
 
-// StoreDetails contains the destination addresses for a data store.
+// StoreDetails contains the destination addresses for a data store. Data is
+// allocated once at its full length when the series is created and then used
+// as a ring. State holds whatever models keep about the series between
+// scorings, and goes away with it.
 type storeDetails struct {
 	Key        string
 	Index      int
@@ -23,24 +27,64 @@ type storeDetails struct {
 	Last       int64
 	Meta       map[string]string
 	MetaString string
-	Data       [max]util.DataPoint
+	Data       []util.DataPoint
 	LastVal    float64
+	State      map[string]interface{} `json:"-"`
 }
 
 // Store contains the individual records.
 type Store struct {
 	*sync.Mutex
-	Data map[string]storeDetails
+	Data    map[string]storeDetails
+	Length  int
+	lengths map[string]int
 }
 
 // NewStore returns a Ring Store
 func NewStore() *Store {
 	var mux sync.Mutex
-	s := Store{&mux, nil}
+	s := Store{&mux, nil, DefaultLength, make(map[string]int)}
 	s.Data = make(map[string]storeDetails)
 	return &s
 }
 
+// SetLengths sets how many points series keep, by default and for the series
+// of particular selectors. Series already stored are resized, keeping their
+// most recent points.
+func (s *Store) SetLengths(def int, bySelector map[string]int) {
+	s.Lock()
+	defer s.Unlock()
+	s.Length = def
+	s.lengths = bySelector
+	for key, val := range s.Data {
+		if length := s.length(val.Meta); length != len(val.Data) {
+			s.Data[key] = s.resize(key, length)
+		}
+	}
+}
+
+// length is how many points a series with these labels should keep.
+func (s *Store) length(kvs map[string]string) int {
+	if length, ok := s.lengths[kvs[util.SelectorLabel]]; ok {
+		return length
+	}
+	return s.Length
+}
+
+// resize copies the most recent points of a series into a ring of a new length.
+func (s *Store) resize(key string, length int) storeDetails {
+	points := s.get(key)
+	if len(points) > length {
+		points = points[len(points)-length:]
+	}
+	temp := s.Data[key]
+	temp.Data = make([]util.DataPoint, length)
+	copy(temp.Data, points)
+	temp.Full = len(points) == length
+	temp.Index = len(points) % length
+	return temp
+}
+
 // UsedKeys reports the used keys in the store.
 func (s *Store) UsedKeys() (out []string) {
 	s.Lock()
@@ -75,9 +119,9 @@ func (s *Store) Add(kvs map[string]string, val float64, dataTime int64) bool {
 	defer s.Unlock()
 	_, ok := s.Data[key]
 	if !ok {
-		store := [max]util.DataPoint{}
+		store := make([]util.DataPoint, s.length(kvs))
 		label, _ := json.Marshal(kvs)
-		base := storeDetails{key, 0, false, -1, kvs, string(label), store, val}
+		base := storeDetails{key, 0, false, -1, kvs, string(label), store, val, make(map[string]interface{})}
 		s.Data[key] = base
 	}
 	// Do not add anything unless it is new
@@ -85,12 +129,13 @@ func (s *Store) Add(kvs map[string]string, val float64, dataTime int64) bool {
 		return false
 	}
 	temp := s.Data[key]
+	length := len(temp.Data)
 	temp.Data[temp.Index] = util.DataPoint{Val: val, Time: dataTime}
 	temp.Last = dataTime
-	if s.Data[key].Index+1 == max {
+	if temp.Index+1 == length {
 		temp.Full = true
 	}
-	temp.Index = (s.Data[key].Index + 1) % max
+	temp.Index = (temp.Index + 1) % length
 	temp.LastVal = val
 	s.Data[key] = temp
 	return true
@@ -106,19 +151,57 @@ func (s *Store) Get(kvs map[string]string) []util.DataPoint {
 
 // get a series for a key
 func (s *Store) get(key string) []util.DataPoint {
-	count := s.Data[key].Index
+	ring := s.Data[key]
+	count := ring.Index
 	start := 0
-	if s.Data[key].Full {
-		count = max
-		start = s.Data[key].Index
+	if ring.Full {
+		count = len(ring.Data)
+		start = ring.Index
 	}
 	out := make([]util.DataPoint, count)
 	for ii := 0; ii < count; ii++ {
-		out[ii] = s.Data[key].Data[(ii+start)%max]
+		out[ii] = ring.Data[(ii+start)%len(ring.Data)]
 	}
 	return out
 }
 
+// ModelState returns what a model keeps about a series, building it with init
+// the first time it is asked for. Series that are not stored have no state.
+func (s *Store) ModelState(kvs map[string]string, model string, init func() interface{}) interface{} {
+	key := util.MapSSToS(kvs)
+	s.Lock()
+	defer s.Unlock()
+	series, ok := s.Data[key]
+	if !ok {
+		return nil
+	}
+	if series.State == nil {
+		series.State = make(map[string]interface{})
+		s.Data[key] = series
+	}
+	if _, ok := series.State[model]; !ok {
+		series.State[model] = init()
+	}
+	return series.State[model]
+}
+
+// ResetModelState drops the state every model but those in keep holds for a
+// series, so they start learning it again from scratch.
+func (s *Store) ResetModelState(kvs map[string]string, keep ...string) {
+	key := util.MapSSToS(kvs)
+	s.Lock()
+	defer s.Unlock()
+	kept := make(map[string]bool, len(keep))
+	for _, model := range keep {
+		kept[model] = true
+	}
+	for model := range s.Data[key].State {
+		if !kept[model] {
+			delete(s.Data[key].State, model)
+		}
+	}
+}
+
 // Delete removes a key from the store
 func (s *Store) Delete(key string) bool {
 	s.Lock()
@@ -144,6 +227,23 @@ func (s *Store) Prune(secs int) map[string]bool {
 	return killList
 }
 
+// PruneLabel removes every series carrying a label with the given value. As in
+// prometheus, a series without the label has it empty.
+func (s *Store) PruneLabel(name, value string) map[string]bool {
+	s.Lock()
+	killList := make(map[string]bool)
+	for key, val := range s.Data {
+		if val.Meta[name] == value {
+			killList[key] = true
+		}
+	}
+	s.Unlock()
+	for key := range killList {
+		s.Delete(key)
+	}
+	return killList
+}
+
 // RingSerialize takes a ringStore and turns it to bytes0
 func (s *Store) RingSerialize() []byte {
 	s.Lock()
@@ -155,7 +255,7 @@ func (s *Store) RingSerialize() []byte {
 // RingDeserialize does the usual deserialization magic on a Ring.
 func RingDeserialize(x []byte) Store {
 	var mux sync.Mutex
-	s := Store{&mux, nil}
+	s := Store{&mux, nil, DefaultLength, make(map[string]int)}
 	json.Unmarshal(x, &s)
 	return s
 }
@@ -44,12 +44,12 @@ func TestAddGet(t *testing.T) {
 	//make sure the elements go in as expected.
 	t.Run("Add-Get3", func(t *testing.T) {
 		x := NewStore()
-		for ii := 0; ii < 44; ii++ {
+		for ii := 0; ii < 2*DefaultLength; ii++ {
 			x.Add(map[string]string{"1": "2"}, float64(ii), int64(ii)+5)
 		}
 		y := x.Get(map[string]string{"1": "2"})
-		for ii := 0; ii < 22; ii++ {
-			if y[ii].Val != float64(ii)+22 {
+		for ii := 0; ii < DefaultLength; ii++ {
+			if y[ii].Val != float64(ii)+DefaultLength {
 				t.Error("mismatch")
 			}
 		}
@@ -87,7 +87,7 @@ func TestAddGetWrap(t *testing.T) {
 		}
 		y := x.Get(map[string]string{"1": "1"})
 		t.Log(y)
-		if (len(y) != max) || (y[0].Val != 1.0) {
+		if (len(y) != DefaultLength) || (y[0].Val != 1.0) {
 			t.Fail()
 		}
 		prevlen := len(y)
@@ -107,7 +107,7 @@ func TestAddGetWrap(t *testing.T) {
 				x.Add(map[string]string{"1": "1"}, 1.0, int64(xx)+1)
 			}
 			y := x.Get(map[string]string{"1": "1"})
-			if (len(y) != max) || (y[0].Val != 1.0) {
+			if (len(y) != DefaultLength) || (y[0].Val != 1.0) {
 				t.Fail()
 			}
 			prevlen := len(y)
@@ -122,7 +122,7 @@ func TestAddGetWrap(t *testing.T) {
 		}
 		y := x.Get(map[string]string{"1": "1"})
 		t.Log(y)
-		if (len(y) != max) || (y[0].Val != 1.0) {
+		if (len(y) != DefaultLength) || (y[0].Val != 1.0) {
 			t.Fail()
 		}
 		prevlen := len(y)
@@ -256,3 +256,93 @@ func BenchmarkGetReal(b *testing.B) {
 		_ = a
 	}
 }
+
+func TestPruneLabel(t *testing.T) {
+	x := NewStore()
+	x.Add(map[string]string{"1": "1", "sel": "a"}, 1.0, 1)
+	x.Add(map[string]string{"1": "2", "sel": "a"}, 1.0, 1)
+	x.Add(map[string]string{"1": "1", "sel": "b"}, 1.0, 1)
+	if g := x.PruneLabel("sel", "a"); len(g) != 2 {
+		t.Error(g)
+	}
+	if g := x.UsedKeys(); len(g) != 1 {
+		t.Error(g)
+	}
+	if g := x.PruneLabel("other", ""); len(g) != 1 {
+		t.Error("series without the label have it empty", g)
+	}
+}
+
+func TestLengths(t *testing.T) {
+	x := NewStore()
+	short := map[string]string{util.SelectorLabel: "short"}
+	other := map[string]string{util.SelectorLabel: "other"}
+	x.SetLengths(5, map[string]int{"short": 3})
+	for ii := 0; ii < 10; ii++ {
+		x.Add(short, float64(ii), int64(ii)+1)
+		x.Add(other, float64(ii), int64(ii)+1)
+	}
+	if g := x.Get(short); len(g) != 3 || g[2].Val != 9 {
+		t.Error(g)
+	}
+	if g := x.Get(other); len(g) != 5 || g[0].Val != 5 {
+		t.Error(g)
+	}
+
+	// growing keeps everything, shrinking keeps the most recent points
+	x.SetLengths(4, map[string]int{"short": 6})
+	if g := x.Get(short); len(g) != 3 || g[0].Val != 7 {
+		t.Error(g)
+	}
+	x.Add(short, 10, 11)
+	if g := x.Get(short); len(g) != 4 || g[3].Val != 10 {
+		t.Error(g)
+	}
+	if g := x.Get(other); len(g) != 4 || g[0].Val != 6 || g[3].Val != 9 {
+		t.Error(g)
+	}
+	x.Add(other, 10, 11)
+	if g := x.Get(other); len(g) != 4 || g[0].Val != 7 || g[3].Val != 10 {
+		t.Error(g)
+	}
+
+	use := x.Usage()
+	if use["short"].Series != 1 || use["short"].Bytes <= use["other"].Bytes {
+		t.Error(use)
+	}
+	x.ReportUsage()
+}
+
+func TestModelState(t *testing.T) {
+	x := NewStore()
+	kvs := map[string]string{"1": "1"}
+	counter := func() interface{} { return new(int) }
+	if g := x.ModelState(kvs, "count", counter); g != nil {
+		t.Error("unknown series have no state", g)
+	}
+	x.Add(kvs, 1.0, time.Now().Unix()-100)
+	*x.ModelState(kvs, "count", counter).(*int) += 2
+	if g := *x.ModelState(kvs, "count", counter).(*int); g != 2 {
+		t.Error(g)
+	}
+	x.SetLengths(5, nil)
+	if g := *x.ModelState(kvs, "count", counter).(*int); g != 2 {
+		t.Error("resizing should keep state", g)
+	}
+	*x.ModelState(kvs, "keep", counter).(*int) = 1
+	*x.ModelState(kvs, "also", counter).(*int) = 3
+	x.ResetModelState(kvs, "keep", "also")
+	if g := *x.ModelState(kvs, "count", counter).(*int); g != 0 {
+		t.Error("resetting should drop state", g)
+	}
+	if g := *x.ModelState(kvs, "keep", counter).(*int) + *x.ModelState(kvs, "also", counter).(*int); g != 4 {
+		t.Error("resetting should keep the state asked for", g)
+	}
+	x.ResetModelState(map[string]string{"2": "2"})
+	*x.ModelState(kvs, "count", counter).(*int) = 2
+	x.Prune(10)
+	x.Add(kvs, 1.0, time.Now().Unix())
+	if g := *x.ModelState(kvs, "count", counter).(*int); g != 0 {
+		t.Error("pruning should drop state", g)
+	}
+}
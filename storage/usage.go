@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"unsafe"
+
+	"github.com/open-fresh/data-sidecar/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	storedSeries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sidecar_storage_series",
+		Help: "Number of series held in the ring store"},
+		[]string{util.SelectorLabel})
+	seriesBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sidecar_storage_series_bytes",
+		Help: "Approximate memory held by each series in the ring store"},
+		[]string{util.SelectorLabel})
+)
+
+func init() {
+	prometheus.MustRegister(storedSeries)
+	prometheus.MustRegister(seriesBytes)
+}
+
+// Usage describes how much the series of one selector take up.
+type Usage struct {
+	Series int
+	Bytes  int
+}
+
+// size approximates the memory a series holds onto.
+func (d storeDetails) size() int {
+	out := int(unsafe.Sizeof(d)) + cap(d.Data)*int(unsafe.Sizeof(util.DataPoint{}))
+	out += len(d.Key) + len(d.MetaString)
+	for key, val := range d.Meta {
+		// a map entry costs about two string headers on top of its contents
+		out += len(key) + len(val) + 32
+	}
+	return out
+}
+
+// Usage reports the number and size of the stored series by selector.
+func (s *Store) Usage() map[string]Usage {
+	s.Lock()
+	defer s.Unlock()
+	out := make(map[string]Usage)
+	for _, val := range s.Data {
+		use := out[val.Meta[util.SelectorLabel]]
+		use.Series++
+		use.Bytes += val.size()
+		out[val.Meta[util.SelectorLabel]] = use
+	}
+	return out
+}
+
+// ReportUsage exports the store's usage as metrics.
+func (s *Store) ReportUsage() {
+	storedSeries.Reset()
+	seriesBytes.Reset()
+	for selector, use := range s.Usage() {
+		storedSeries.WithLabelValues(selector).Set(float64(use.Series))
+		seriesBytes.WithLabelValues(selector).Set(float64(use.Bytes) / float64(use.Series))
+	}
+}
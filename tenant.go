@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/open-fresh/data-sidecar/config"
+	"github.com/open-fresh/data-sidecar/icarus"
+	"github.com/open-fresh/data-sidecar/prom"
+	"github.com/open-fresh/data-sidecar/scoring"
+	"github.com/open-fresh/data-sidecar/storage"
+)
+
+// tenant is the client fetching the series of one tenant and the scorer they
+// go through. Tenants share the store and the exposition; their series are
+// told apart by their tenant label.
+type tenant struct {
+	client *prom.Client
+	scorer *scoring.Scorer
+}
+
+// newTenant builds the pieces for one tenant from cfg without starting them.
+func newTenant(cfg config.Config, settings config.Tenant, store *storage.Store, remote *icarus.Icarus) *tenant {
+	scorer := scoring.NewScorer(store, remote)
+	client := prom.NewClient(cfg.Prometheus, cfg.Selectors(), cfg.Resolution, cfg.Lookback, scorer)
+	scorer.SetHistory(client)
+	t := &tenant{client, scorer}
+	t.apply(cfg, settings)
+	return t
+}
+
+// apply brings a tenant in line with cfg and returns the selectors whose
+// series were reset because their models changed. The client is paused while
+// every group receives, since there is nothing to fetch.
+func (t *tenant) apply(cfg config.Config, settings config.Tenant) []string {
+	t.client.Reload(cfg.Prometheus, cfg.Selectors(), cfg.Resolution, cfg.Lookback)
+	if len(cfg.Selectors()) == 0 {
+		t.client.Stop()
+	} else if t.client.Stopped {
+		t.client.Restart()
+	}
+	t.client.SetPool(cfg.QueryWorkers, time.Duration(cfg.QueryTimeout)*time.Second)
+	t.client.SetBackfill(cfg.MaxBackfill)
+	t.client.SetRemoteRead(cfg.RemoteRead)
+	t.client.SetTenant(settings.ID, settings.QueryRate)
+	if err := t.client.SetAuth(clientAuth(cfg)); err != nil {
+		log.Println("error setting prometheus credentials:", err)
+	}
+	return t.scorer.SetModels(cfg.ModelsBySelector())
+}
+
+// configureExport sets up how results are exposed and sent as cfg says.
+// Series stop being exposed with timestamps once they fall two steps behind.
+func configureExport(remote *icarus.Icarus, cfg config.Config) {
+	remote.SetPrefix(cfg.Prefix)
+	remote.SetHelp(scoring.Help)
+	remote.SetTimestamps(cfg.Timestamps, int64(2*cfg.Resolution))
+	w := cfg.RemoteWrite
+	remote.SetRemoteWrite(w.URL, w.Capacity, w.BatchSize, time.Duration(w.Deadline)*time.Second, w.MaxRetries)
+}
+
+// clientAuth picks the settings for authenticating to prometheus out of cfg.
+func clientAuth(cfg config.Config) prom.Auth {
+	auth := prom.Auth{
+		BearerToken:        cfg.BearerToken,
+		BearerTokenFile:    cfg.BearerTokenFile,
+		CAFile:             cfg.TLS.CAFile,
+		CertFile:           cfg.TLS.CertFile,
+		KeyFile:            cfg.TLS.KeyFile,
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+	if cfg.BasicAuth != nil {
+		auth.Username = cfg.BasicAuth.Username
+		auth.Password = cfg.BasicAuth.Password
+		auth.PasswordFile = cfg.BasicAuth.PasswordFile
+	}
+	return auth
+}
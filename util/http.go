@@ -16,3 +16,15 @@ func SingleConnNoKeepAliveTransporter() *http.Transport {
 		TLSHandshakeTimeout: 5 * time.Second,
 	}
 }
+
+// PooledTransporter returns a transporter that keeps up to conns connections
+// alive, so queries running side by side reuse them instead of dialing anew.
+func PooledTransporter(conns int) *http.Transport {
+	return &http.Transport{
+		Dial:                (&net.Dialer{Timeout: 5 * time.Second}).Dial,
+		MaxIdleConns:        conns,
+		MaxIdleConnsPerHost: conns,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+	}
+}
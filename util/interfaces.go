@@ -6,11 +6,12 @@ type Recorder interface {
 	Finish()
 }
 
-// ScoringEngine is whatever scores datapoints.
+// ScoringEngine is whatever scores datapoints. ScoreData is told the time from
+// which points are current; older points are backfill.
 type ScoringEngine interface {
 	Add(map[string]string, float64, int64) bool
 	Score(map[string]string)
-	ScoreData([]DataPoint, map[string]string, bool)
+	ScoreData([]DataPoint, map[string]string, int64)
 }
 
 // StorageEngine is whatever handles the data work.
@@ -18,4 +19,14 @@ type StorageEngine interface {
 	Add(map[string]string, float64, int64) bool
 	Get(map[string]string) []DataPoint
 	UsedKeys() []string
+	PruneLabel(string, string) map[string]bool
+	ModelState(map[string]string, string, func() interface{}) interface{}
+	ResetModelState(map[string]string, ...string)
+}
+
+// HistoryEngine looks up what a series did between two times, and what an
+// expression evaluates to at a time.
+type HistoryEngine interface {
+	History(map[string]string, int64, int64) ([]DataPoint, error)
+	Evaluate(string, int64) ([]Series, error)
 }
@@ -1,5 +1,14 @@
 package util
 
+// SelectorLabel carries the selector a series was fetched with, so results
+// from different selectors never collide.
+const SelectorLabel = "ft_selector"
+
+// TenantLabel carries the tenant a series belongs to when the sidecar fetches
+// for several tenants of a multi-tenant prometheus. It is prefixed like
+// SelectorLabel, as series there often have a tenant label of their own.
+const TenantLabel = "ft_tenant"
+
 //Metric is a metric packet
 type Metric struct {
 	Desc map[string]string
@@ -11,3 +20,9 @@ type DataPoint struct {
 	Val  float64
 	Time int64
 }
+
+// Series is a labelled run of points.
+type Series struct {
+	Labels map[string]string
+	Data   []DataPoint
+}